@@ -36,6 +36,12 @@ func Run() {
 			Usage: "Log level (options: debug, info, warn, error, fatal, panic)",
 		},
 
+		cli.StringFlag{
+			Name:  "log-format",
+			Value: "text",
+			Usage: "Log format (options: text, json)",
+		},
+
 		cli.BoolFlag{
 			Name:  "experimental",
 			Usage: "enable experimental features",
@@ -51,6 +57,14 @@ func Run() {
 		}
 		log.SetLevel(level)
 
+		switch c.String("log-format") {
+		case "text":
+		case "json":
+			log.SetFormatter(&log.JSONFormatter{})
+		default:
+			log.Fatalf("invalid log format %q (options: text, json)", c.String("log-format"))
+		}
+
 		// If a log level wasn't specified and we are running in debug mode,
 		// enforce log-level=debug.
 		if !c.IsSet("log-level") && !c.IsSet("l") && c.Bool("debug") {
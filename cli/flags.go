@@ -86,6 +86,11 @@ var (
 		Value: 3,
 		Usage: "set engine failure retry count",
 	}
+	flRescheduleLoadWindow = cli.StringFlag{
+		Name:  "engine-reschedule-load-window",
+		Value: "1h",
+		Usage: "set how long a rescheduled container counts towards the reschedule load of its engine",
+	}
 	flEnableCors = cli.BoolFlag{
 		Name:  "api-enable-cors, cors",
 		Usage: "enable CORS headers in the remote API",
@@ -256,10 +256,15 @@ func manage(c *cli.Context) {
 	if failureRetry <= 0 {
 		log.Fatal("invalid failure retry count")
 	}
+	rescheduleLoadWindow := c.Duration("engine-reschedule-load-window")
+	if rescheduleLoadWindow <= 0 {
+		log.Fatal("reschedule load window should be a positive duration")
+	}
 	engineOpts := &cluster.EngineOpts{
-		RefreshMinInterval: refreshMinInterval,
-		RefreshMaxInterval: refreshMaxInterval,
-		FailureRetry:       failureRetry,
+		RefreshMinInterval:   refreshMinInterval,
+		RefreshMaxInterval:   refreshMaxInterval,
+		FailureRetry:         failureRetry,
+		RescheduleLoadWindow: rescheduleLoadWindow,
 	}
 
 	uri := getDiscovery(c)
@@ -75,12 +75,26 @@ type Cluster interface {
 	// TotalCpus returns the number of CPUs in the cluster.
 	TotalCpus() int64
 
+	// UsedMemory returns the memory reserved by containers in the cluster.
+	UsedMemory() int64
+
+	// UsedCpus returns the number of CPUs reserved by containers in the cluster.
+	UsedCpus() int64
+
 	// EngineNames returns the names of all the engines in the cluster.
 	EngineNames() []string
 
 	// RegisterEventHandler registers an event handler for cluster-wide events.
 	RegisterEventHandler(h EventHandler) error
 
+	// RegisterFilteredEventHandler registers an event handler which only
+	// receives the cluster-wide events matching the filter.
+	RegisterFilteredEventHandler(f EventFilter, h EventHandler) error
+
+	// RegisterEventHandlerWithReplay registers an event handler which also
+	// receives the recent events kept by the cluster.
+	RegisterEventHandlerWithReplay(h EventHandler) error
+
 	// UnregisterEventHandler unregisters an event handler.
 	UnregisterEventHandler(h EventHandler)
 
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
 	"strings"
 
 	"github.com/docker/docker/api/types/container"
@@ -13,6 +14,16 @@ import (
 // SwarmLabelNamespace defines the key prefix in all custom labels
 const SwarmLabelNamespace = "com.docker.swarm"
 
+// Pull policies, set with the com.docker.swarm.pull-policy label
+const (
+	// PullAlways pulls the image before creating the container
+	PullAlways = "always"
+	// PullIfNotPresent pulls the image only if the engine doesn't have it
+	PullIfNotPresent = "if-not-present"
+	// PullNever never pulls the image
+	PullNever = "never"
+)
+
 // ContainerConfig is exported
 // TODO store affinities and constraints in their own fields
 type ContainerConfig struct {
@@ -40,6 +51,41 @@ func parseEnv(e string) (bool, string, string) {
 	return false, "", ""
 }
 
+// isSwarmEnv returns true if the env key is interpreted by swarm rather than
+// passed to the container.
+func isSwarmEnv(key string) bool {
+	switch key {
+	case "affinity", "constraint", "reschedule", "whitelist":
+		return true
+	}
+	return false
+}
+
+// uniq returns values without duplicates, keeping the first occurrence.
+func uniq(values []string) []string {
+	var (
+		out  []string
+		seen = make(map[string]bool)
+	)
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// RequestedMemory returns the memory, in bytes, reserved by the container.
+func (c *ContainerConfig) RequestedMemory() int64 {
+	return c.HostConfig.Memory
+}
+
+// RequestedCPUShares returns the CPUs reserved by the container.
+func (c *ContainerConfig) RequestedCPUShares() int64 {
+	return c.HostConfig.CPUShares
+}
+
 // ConsolidateResourceFields is a temporary fix to handle forward/backward compatibility between Docker <1.6 and >=1.7
 func ConsolidateResourceFields(c *OldContainerConfig) {
 	if c.Memory != c.HostConfig.Memory && c.Memory != 0 {
@@ -59,6 +105,22 @@ func ConsolidateResourceFields(c *OldContainerConfig) {
 	}
 }
 
+// BuildContainerConfigChecked is like BuildContainerConfig but returns an error
+// when the affinities, constraints, whitelists or reschedule policies labels
+// are not valid JSON, instead of ignoring them.
+func BuildContainerConfigChecked(c container.Config, h container.HostConfig, n network.NetworkingConfig) (*ContainerConfig, error) {
+	for _, name := range []string{"affinities", "constraints", "whitelists", "reschedule-policies"} {
+		key := SwarmLabelNamespace + "." + name
+		if labels, ok := c.Labels[key]; ok {
+			var values []string
+			if err := json.Unmarshal([]byte(labels), &values); err != nil {
+				return nil, fmt.Errorf("invalid label %s: %v", key, err)
+			}
+		}
+	}
+	return BuildContainerConfig(c, h, n), nil
+}
+
 // BuildContainerConfig creates a cluster.ContainerConfig from a Config, HostConfig, and NetworkingConfig
 func BuildContainerConfig(c container.Config, h container.HostConfig, n network.NetworkingConfig) *ContainerConfig {
 	var (
@@ -66,6 +128,7 @@ func BuildContainerConfig(c container.Config, h container.HostConfig, n network.
 		constraints        []string
 		whitelists         []string
 		reschedulePolicies []string
+		escapedEnv         []string
 		env                []string
 	)
 
@@ -94,9 +157,26 @@ func BuildContainerConfig(c container.Config, h container.HostConfig, n network.
 		json.Unmarshal([]byte(labels), &reschedulePolicies)
 	}
 
+	// parse the env vars which were escaped when the container was created,
+	// so they aren't taken for expressions when the config is built again
+	// from the engine (ex. com.docker.swarm.escaped-env=["affinity:foo"])
+	if labels, ok := c.Labels[SwarmLabelNamespace+".escaped-env"]; ok {
+		json.Unmarshal([]byte(labels), &escapedEnv)
+	}
+	escaped := make(map[string]bool)
+	for _, e := range escapedEnv {
+		escaped[e] = true
+	}
+
 	// parse affinities/constraints/whitelists/reschedule policies from env (ex. docker run -e affinity:container==redis -e affinity:image==nginx -e constraint:region==us-east -e constraint:storage==ssd -e reschedule:off)
+	// a leading backslash escapes them (ex. docker run -e '\affinity:foo' sets the env var affinity:foo)
 	for _, e := range c.Env {
-		if ok, key, value := parseEnv(e); ok && key == "affinity" {
+		if ok, key, _ := parseEnv(strings.TrimPrefix(e, `\`)); ok && strings.HasPrefix(e, `\`) && isSwarmEnv(key) {
+			env = append(env, e[1:])
+			escapedEnv = append(escapedEnv, e[1:])
+		} else if escaped[e] {
+			env = append(env, e)
+		} else if ok, key, value := parseEnv(e); ok && key == "affinity" {
 			affinities = append(affinities, value)
 		} else if ok && key == "constraint" {
 			constraints = append(constraints, value)
@@ -112,6 +192,13 @@ func BuildContainerConfig(c container.Config, h container.HostConfig, n network.
 	// remove affinities/constraints/whitelists/reschedule policies from env
 	c.Env = env
 
+	// expressions from labels and env are merged, drop the duplicates
+	affinities = uniq(affinities)
+	constraints = uniq(constraints)
+	reschedulePolicies = uniq(reschedulePolicies)
+	whitelists = uniq(whitelists)
+	escapedEnv = uniq(escapedEnv)
+
 	// store affinities in labels
 	if len(affinities) > 0 {
 		if labels, err := json.Marshal(affinities); err == nil {
@@ -140,6 +227,13 @@ func BuildContainerConfig(c container.Config, h container.HostConfig, n network.
 		}
 	}
 
+	// store escaped env vars in labels
+	if len(escapedEnv) > 0 {
+		if labels, err := json.Marshal(escapedEnv); err == nil {
+			c.Labels[SwarmLabelNamespace+".escaped-env"] = string(labels)
+		}
+	}
+
 	return &ContainerConfig{c, h, n}
 }
 
@@ -153,6 +247,28 @@ func (c *ContainerConfig) extractExprs(key string) []string {
 	return exprs
 }
 
+// Copy returns a copy of the config which can be changed, constraints and
+// affinities included, without affecting c.
+func (c *ContainerConfig) Copy() *ContainerConfig {
+	config := *c
+	if c.Labels != nil {
+		config.Labels = make(map[string]string, len(c.Labels))
+		for k, v := range c.Labels {
+			config.Labels[k] = v
+		}
+	}
+	if c.Env != nil {
+		config.Env = append([]string{}, c.Env...)
+	}
+	if c.NetworkingConfig.EndpointsConfig != nil {
+		config.NetworkingConfig.EndpointsConfig = make(map[string]*network.EndpointSettings, len(c.NetworkingConfig.EndpointsConfig))
+		for k, v := range c.NetworkingConfig.EndpointsConfig {
+			config.NetworkingConfig.EndpointsConfig[k] = v
+		}
+	}
+	return &config
+}
+
 // SwarmID extracts the Swarm ID from the Config.
 // May return an empty string if not set.
 func (c *ContainerConfig) SwarmID() string {
@@ -247,6 +363,22 @@ func (c *ContainerConfig) AddConstraint(constraint string) error {
 	return nil
 }
 
+// RemoveConstraint from config
+func (c *ContainerConfig) RemoveConstraint(constraint string) error {
+	constraints := []string{}
+	for _, a := range c.extractExprs("constraints") {
+		if a != constraint {
+			constraints = append(constraints, a)
+		}
+	}
+	labels, err := json.Marshal(constraints)
+	if err != nil {
+		return err
+	}
+	c.Labels[SwarmLabelNamespace+".constraints"] = string(labels)
+	return nil
+}
+
 // HaveNodeConstraint in config
 func (c *ContainerConfig) HaveNodeConstraint() bool {
 	constraints := c.extractExprs("constraints")
@@ -269,23 +401,101 @@ func (c *ContainerConfig) HasReschedulePolicy(p string) bool {
 	return false
 }
 
+// PullPolicy returns the pull policy of the container, PullIfNotPresent by default
+func (c *ContainerConfig) PullPolicy() string {
+	if policy, ok := c.Labels[SwarmLabelNamespace+".pull-policy"]; ok {
+		return policy
+	}
+	return PullIfNotPresent
+}
+
+// userLabels returns the labels of the config, without the ones used
+// internally by swarm.
+func (c *ContainerConfig) userLabels() map[string]string {
+	labels := make(map[string]string)
+	for k, v := range c.Labels {
+		if !strings.HasPrefix(k, SwarmLabelNamespace+".") {
+			labels[k] = v
+		}
+	}
+	return labels
+}
+
+// Diff returns the names of the fields which differ between c and other:
+// Image, Env, Labels, ExposedPorts, Memory, MemorySwap, CPUShares and
+// CpusetCpus. Labels in the swarm namespace are ignored.
+func (c *ContainerConfig) Diff(other *ContainerConfig) []string {
+	diff := []string{}
+	if c.Image != other.Image {
+		diff = append(diff, "Image")
+	}
+	if !equalStrings(c.Env, other.Env) {
+		diff = append(diff, "Env")
+	}
+	if !reflect.DeepEqual(c.userLabels(), other.userLabels()) {
+		diff = append(diff, "Labels")
+	}
+	if (len(c.ExposedPorts) > 0 || len(other.ExposedPorts) > 0) && !reflect.DeepEqual(c.ExposedPorts, other.ExposedPorts) {
+		diff = append(diff, "ExposedPorts")
+	}
+	if c.HostConfig.Memory != other.HostConfig.Memory {
+		diff = append(diff, "Memory")
+	}
+	if c.HostConfig.MemorySwap != other.HostConfig.MemorySwap {
+		diff = append(diff, "MemorySwap")
+	}
+	if c.HostConfig.CPUShares != other.HostConfig.CPUShares {
+		diff = append(diff, "CPUShares")
+	}
+	if c.HostConfig.CpusetCpus != other.HostConfig.CpusetCpus {
+		diff = append(diff, "CpusetCpus")
+	}
+	return diff
+}
+
+// equalStrings returns true if a and b hold the same strings, in the same
+// order. nil and empty slices are equal.
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // Validate returns an error if the config isn't valid
 func (c *ContainerConfig) Validate() error {
 	//TODO: add validation for affinities and constraints
+	// on-node-failure and on-unhealthy can be combined, off can't be
+	// combined with anything.
 	reschedulePolicies := c.extractExprs("reschedule-policies")
-	if len(reschedulePolicies) > 1 {
-		return errors.New("too many reschedule policies")
-	} else if len(reschedulePolicies) == 1 {
+	for _, reschedulePolicy := range reschedulePolicies {
 		valid := false
-		for _, validReschedulePolicy := range []string{"off", "on-node-failure"} {
-			if reschedulePolicies[0] == validReschedulePolicy {
+		for _, validReschedulePolicy := range []string{"off", "on-node-failure", "on-unhealthy"} {
+			if reschedulePolicy == validReschedulePolicy {
 				valid = true
 			}
 		}
 		if !valid {
-			return fmt.Errorf("invalid reschedule policy: %s", reschedulePolicies[0])
+			return fmt.Errorf("invalid reschedule policy: %s", reschedulePolicy)
+		}
+		if len(reschedulePolicies) > 1 && reschedulePolicy == "off" {
+			return errors.New("too many reschedule policies")
 		}
 	}
+	if len(reschedulePolicies) > 2 {
+		return errors.New("too many reschedule policies")
+	}
+
+	switch policy := c.PullPolicy(); policy {
+	case PullAlways, PullIfNotPresent, PullNever:
+	default:
+		return fmt.Errorf("invalid pull policy: %s", policy)
+	}
 
 	return nil
 }
@@ -28,6 +28,24 @@ func TestBuildContainerConfig(t *testing.T) {
 	config = BuildContainerConfig(container.Config{Env: []string{"test=true", "constraint:test==true", "affinity:container==test"}}, container.HostConfig{}, network.NetworkingConfig{})
 	assert.Len(t, config.Env, 1)
 	assert.Len(t, config.Labels, 2)
+
+	// Escaped entries are kept as regular env vars.
+	config = BuildContainerConfig(container.Config{Env: []string{`\affinity:container==test`, `\constraint:foo`, "constraint:test==true"}}, container.HostConfig{}, network.NetworkingConfig{})
+	assert.Equal(t, config.Env, []string{"affinity:container==test", "constraint:foo"})
+	assert.Len(t, config.Labels, 2)
+	assert.Equal(t, config.Labels["com.docker.swarm.escaped-env"], `["affinity:container==test","constraint:foo"]`)
+	assert.Empty(t, config.Affinities())
+	assert.Equal(t, config.Constraints(), []string{"test==true"})
+
+	// They remain escaped when the config is built again from the engine.
+	config = BuildContainerConfig(config.Config, container.HostConfig{}, network.NetworkingConfig{})
+	assert.Equal(t, config.Env, []string{"affinity:container==test", "constraint:foo"})
+	assert.Empty(t, config.Affinities())
+	assert.Equal(t, config.Constraints(), []string{"test==true"})
+
+	// Other entries starting with a backslash are left untouched.
+	config = BuildContainerConfig(container.Config{Env: []string{`\foo:bar`, `\test=true`}}, container.HostConfig{}, network.NetworkingConfig{})
+	assert.Equal(t, config.Env, []string{`\foo:bar`, `\test=true`})
 }
 
 func TestSwarmID(t *testing.T) {
@@ -64,6 +82,53 @@ func TestAffinities(t *testing.T) {
 	config = BuildContainerConfig(container.Config{Env: []string{"test=true", "constraint:test==true", "affinity:container==test"}}, container.HostConfig{}, network.NetworkingConfig{})
 	assert.Len(t, config.Affinities(), 1)
 	assert.Equal(t, len(config.Affinities()), 1)
+
+	// soft affinities keep their marker
+	config = BuildContainerConfig(container.Config{Env: []string{"affinity:container==~redis"}}, container.HostConfig{}, network.NetworkingConfig{})
+	assert.Equal(t, config.Affinities(), []string{"container==~redis"})
+	assert.Equal(t, config.Labels[SwarmLabelNamespace+".affinities"], `["container==~redis"]`)
+}
+
+func TestMergeLabelsAndEnv(t *testing.T) {
+	config := BuildContainerConfig(container.Config{
+		Env: []string{"constraint:region==us-east", "constraint:storage==ssd", "affinity:image==nginx"},
+		Labels: map[string]string{
+			SwarmLabelNamespace + ".constraints": `["region==us-east","node==node1"]`,
+			SwarmLabelNamespace + ".affinities":  `["container==redis"]`,
+		},
+	}, container.HostConfig{}, network.NetworkingConfig{})
+	assert.Empty(t, config.Env)
+	assert.Equal(t, config.Constraints(), []string{"region==us-east", "node==node1", "storage==ssd"})
+	assert.Equal(t, config.Affinities(), []string{"container==redis", "image==nginx"})
+
+	config = BuildContainerConfig(container.Config{
+		Env: []string{"affinity:container==redis", "affinity:container==redis"},
+		Labels: map[string]string{
+			SwarmLabelNamespace + ".affinities": `["container==redis"]`,
+		},
+	}, container.HostConfig{}, network.NetworkingConfig{})
+	assert.Equal(t, config.Affinities(), []string{"container==redis"})
+}
+
+func TestBuildContainerConfigChecked(t *testing.T) {
+	config, err := BuildContainerConfigChecked(container.Config{
+		Env: []string{"constraint:region==us-east"},
+		Labels: map[string]string{
+			SwarmLabelNamespace + ".affinities": `["container==redis"]`,
+		},
+	}, container.HostConfig{}, network.NetworkingConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, config.Constraints(), []string{"region==us-east"})
+	assert.Equal(t, config.Affinities(), []string{"container==redis"})
+
+	for _, name := range []string{"affinities", "constraints", "whitelists", "reschedule-policies"} {
+		labels := map[string]string{SwarmLabelNamespace + "." + name: `["foo==bar"`}
+		_, err = BuildContainerConfigChecked(container.Config{Labels: labels}, container.HostConfig{}, network.NetworkingConfig{})
+		assert.Error(t, err, name)
+
+		// the lenient version ignores the invalid label
+		assert.NotNil(t, BuildContainerConfig(container.Config{Labels: labels}, container.HostConfig{}, network.NetworkingConfig{}))
+	}
 }
 
 func TestConsolidateResourceFields(t *testing.T) {
@@ -97,6 +162,35 @@ func TestRemoveAffinity(t *testing.T) {
 	assert.Equal(t, config.Affinities()[0], "image==~testimage2")
 }
 
+func TestRemoveConstraint(t *testing.T) {
+	config := BuildContainerConfig(container.Config{}, container.HostConfig{}, network.NetworkingConfig{})
+	assert.Empty(t, config.Constraints())
+
+	config.AddConstraint("region==us-east")
+	config.AddConstraint("node==node1")
+	assert.Len(t, config.Constraints(), 2)
+
+	config.RemoveConstraint("node==node1")
+	assert.Equal(t, config.Constraints(), []string{"region==us-east"})
+}
+
+func TestCopy(t *testing.T) {
+	config := BuildContainerConfig(container.Config{Env: []string{"constraint:region==us-east", "FOO=bar"}}, container.HostConfig{}, network.NetworkingConfig{})
+	labels := map[string]string{}
+	for k, v := range config.Labels {
+		labels[k] = v
+	}
+
+	copied := config.Copy()
+	copied.AddConstraint("node==node1")
+	copied.SetSwarmID("swarm-id")
+	copied.Env[0] = "FOO=baz"
+
+	assert.Equal(t, labels, config.Labels)
+	assert.Equal(t, []string{"FOO=bar"}, config.Env)
+	assert.Equal(t, []string{"region==us-east", "node==node1"}, copied.Constraints())
+}
+
 func TestHaveNodeConstraint(t *testing.T) {
 	config := BuildContainerConfig(container.Config{}, container.HostConfig{}, network.NetworkingConfig{})
 	assert.False(t, config.HaveNodeConstraint())
@@ -104,3 +198,76 @@ func TestHaveNodeConstraint(t *testing.T) {
 	config = BuildContainerConfig(container.Config{Env: []string{"constraint:node==node1"}}, container.HostConfig{}, network.NetworkingConfig{})
 	assert.True(t, config.HaveNodeConstraint())
 }
+
+func TestPullPolicy(t *testing.T) {
+	config := BuildContainerConfig(container.Config{}, container.HostConfig{}, network.NetworkingConfig{})
+	assert.Equal(t, config.PullPolicy(), PullIfNotPresent)
+	assert.NoError(t, config.Validate())
+
+	for _, policy := range []string{PullAlways, PullIfNotPresent, PullNever} {
+		config = BuildContainerConfig(container.Config{Labels: map[string]string{SwarmLabelNamespace + ".pull-policy": policy}}, container.HostConfig{}, network.NetworkingConfig{})
+		assert.Equal(t, config.PullPolicy(), policy)
+		assert.NoError(t, config.Validate())
+	}
+
+	config = BuildContainerConfig(container.Config{Labels: map[string]string{SwarmLabelNamespace + ".pull-policy": "sometimes"}}, container.HostConfig{}, network.NetworkingConfig{})
+	assert.Equal(t, config.PullPolicy(), "sometimes")
+	assert.Error(t, config.Validate())
+}
+
+func TestDiff(t *testing.T) {
+	build := func(c container.Config, h container.HostConfig) *ContainerConfig {
+		return BuildContainerConfig(c, h, network.NetworkingConfig{})
+	}
+	base := container.Config{
+		Image:  "nginx",
+		Env:    []string{"FOO=bar", "constraint:region==us-east"},
+		Labels: map[string]string{"tier": "web"},
+	}
+	config := build(base, container.HostConfig{})
+
+	// Identical configs.
+	assert.Empty(t, config.Diff(build(base, container.HostConfig{})))
+
+	// Image change.
+	changed := base
+	changed.Image = "nginx:alpine"
+	assert.Equal(t, config.Diff(build(changed, container.HostConfig{})), []string{"Image"})
+
+	// Env change.
+	changed = base
+	changed.Env = []string{"FOO=baz", "constraint:region==us-east"}
+	assert.Equal(t, config.Diff(build(changed, container.HostConfig{})), []string{"Env"})
+
+	// Label and resources change.
+	changed = base
+	changed.Labels = map[string]string{"tier": "cache"}
+	assert.Equal(t, config.Diff(build(changed, container.HostConfig{Resources: container.Resources{Memory: 1024, CPUShares: 2}})), []string{"Labels", "Memory", "CPUShares"})
+
+	// Swarm labels are ignored, including the ones set from env.
+	changed = base
+	changed.Env = []string{"FOO=bar", "constraint:region==eu"}
+	changed.Labels = map[string]string{"tier": "web", SwarmLabelNamespace + ".id": "swarm-id"}
+	assert.Empty(t, config.Diff(build(changed, container.HostConfig{})))
+}
+
+func TestValidateReschedulePolicies(t *testing.T) {
+	build := func(policies ...string) *ContainerConfig {
+		env := []string{}
+		for _, policy := range policies {
+			env = append(env, "reschedule:"+policy)
+		}
+		return BuildContainerConfig(container.Config{Env: env}, container.HostConfig{}, network.NetworkingConfig{})
+	}
+
+	assert.NoError(t, build().Validate())
+	assert.NoError(t, build("off").Validate())
+	assert.NoError(t, build("on-node-failure").Validate())
+	assert.NoError(t, build("on-unhealthy").Validate())
+	assert.NoError(t, build("on-node-failure", "on-unhealthy").Validate())
+	assert.True(t, build("on-node-failure", "on-unhealthy").HasReschedulePolicy("on-unhealthy"))
+
+	assert.Error(t, build("false").Validate())
+	assert.Error(t, build("off", "on-unhealthy").Validate())
+	assert.Error(t, build("on-node-failure", "off").Validate())
+}
@@ -2,6 +2,7 @@ package cluster
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
@@ -17,6 +18,20 @@ type Container struct {
 	Config *ContainerConfig
 	Info   types.ContainerJSON
 	Engine *Engine
+
+	// Placement is set on the containers created by the cluster.
+	Placement *Placement
+}
+
+// Placement records why a container was placed on its node.
+type Placement struct {
+	// Constraints and Affinities are the expressions met by the node.
+	Constraints []string
+	Affinities  []string
+	// Labels are the values of the node the constraints were matched
+	// against, by key, the ones computed by swarm (ex. containers)
+	// included. Several values are separated by commas.
+	Labels map[string]string
 }
 
 // StateString returns a single string to describe state
@@ -98,9 +113,108 @@ func (c *Container) Refresh() (*Container, error) {
 	return c.Engine.refreshContainer(c.ID, true)
 }
 
+// IsSwarmManaged returns true if the container was scheduled by swarm, as
+// opposed to created directly on an engine.
+func (c *Container) IsSwarmManaged() bool {
+	return c.Config != nil && c.Config.SwarmID() != ""
+}
+
 // Containers represents a list of containers
 type Containers []*Container
 
+// SortBy sorts the containers in place using less to compare them.
+// Containers which compare equal keep their original order.
+func (containers Containers) SortBy(less func(a, b *Container) bool) {
+	sort.SliceStable(containers, func(i, j int) bool {
+		return less(containers[i], containers[j])
+	})
+}
+
+// ByCreation orders containers by creation time, then by ID.
+func ByCreation(a, b *Container) bool {
+	if a.Created != b.Created {
+		return a.Created < b.Created
+	}
+	return a.ID < b.ID
+}
+
+// FilterByHealth returns the containers whose health status, as described by
+// HealthString, is status. Containers without a known state are reported as
+// having no health check.
+func (containers Containers) FilterByHealth(status string) Containers {
+	out := Containers{}
+	for _, container := range containers {
+		health := types.NoHealthcheck
+		if container.Info.ContainerJSONBase != nil && container.Info.State != nil {
+			health = HealthString(container.Info.State)
+		}
+		if health == status {
+			out = append(out, container)
+		}
+	}
+	return out
+}
+
+// FilterByState returns the containers whose state, as described by
+// StateString, is state. Containers without a known state are skipped.
+func (containers Containers) FilterByState(state string) Containers {
+	out := Containers{}
+	for _, container := range containers {
+		if container.Info.ContainerJSONBase == nil || container.Info.State == nil {
+			continue
+		}
+		if StateString(container.Info.State) == state {
+			out = append(out, container)
+		}
+	}
+	return out
+}
+
+// FilterByLabel returns the containers whose label key is set to value.
+func (containers Containers) FilterByLabel(key, value string) Containers {
+	out := Containers{}
+	for _, container := range containers {
+		if v, ok := container.Labels[key]; ok && v == value {
+			out = append(out, container)
+		}
+	}
+	return out
+}
+
+// LabelValues returns the sorted, distinct values of the label key across
+// containers. Containers without the label are ignored.
+func (containers Containers) LabelValues(key string) []string {
+	seen := make(map[string]struct{})
+	values := []string{}
+	for _, container := range containers {
+		v, ok := container.Labels[key]
+		if !ok {
+			continue
+		}
+		if _, ok := seen[v]; !ok {
+			seen[v] = struct{}{}
+			values = append(values, v)
+		}
+	}
+	sort.Strings(values)
+	return values
+}
+
+// FilterByPublishedPort returns the containers publishing port on the host,
+// whatever the protocol.
+func (containers Containers) FilterByPublishedPort(port int) Containers {
+	out := Containers{}
+	for _, container := range containers {
+		for _, p := range container.Ports {
+			if int(p.PublicPort) == port {
+				out = append(out, container)
+				break
+			}
+		}
+	}
+	return out
+}
+
 // Get returns a container using its ID or Name
 func (containers Containers) Get(IDOrName string) *Container {
 	// Abort immediately if the name is empty.
@@ -115,10 +229,16 @@ func (containers Containers) Get(IDOrName string) *Container {
 		}
 	}
 
-	// Match exact Swarm ID.
+	// Match exact Swarm ID, or engine/swarmID.
 	for _, container := range containers {
-		if swarmID := container.Config.SwarmID(); swarmID == IDOrName || stringid.TruncateID(swarmID) == IDOrName {
-			return container
+		swarmID := container.Config.SwarmID()
+		if swarmID == "" {
+			continue
+		}
+		for _, id := range []string{swarmID, stringid.TruncateID(swarmID)} {
+			if id == IDOrName || container.Engine.ID+"/"+id == IDOrName || container.Engine.Name+"/"+id == IDOrName {
+				return container
+			}
 		}
 	}
 
@@ -128,6 +248,9 @@ func (containers Containers) Get(IDOrName string) *Container {
 	for _, container := range containers {
 		found := false
 		for _, name := range container.Names {
+			// names normally have a leading slash, make sure of it for
+			// the engine/name form
+			name = "/" + strings.TrimPrefix(name, "/")
 			if name == IDOrName || name == "/"+IDOrName || container.Engine.ID+name == IDOrName || container.Engine.Name+name == IDOrName {
 				found = true
 			}
@@ -48,6 +48,8 @@ func TestContainersGet(t *testing.T) {
 	// Container engine/name matching.
 	assert.NotNil(t, containers.Get("test-engine/container1-name1"))
 	assert.NotNil(t, containers.Get("test-engine/container1-name2"))
+	assert.Nil(t, containers.Get("test-engine//container1-name1"))
+	assert.Nil(t, containers.Get("test-enginecontainer1-name1"))
 	// Swarm ID lookup.
 	assert.NotNil(t, containers.Get("swarm1-id"))
 	// Swarm ID prefix lookup.
@@ -57,4 +59,200 @@ func TestContainersGet(t *testing.T) {
 	cc := containers.Get("con")
 	assert.NotNil(t, cc)
 	assert.Equal(t, cc.ID, "container2-id")
+
+	// Names without a leading slash are matched the same way.
+	containers = Containers{{
+		Container: types.Container{ID: "container3-id", Names: []string{"web"}},
+		Engine:    &Engine{ID: "worker-1-id", Name: "worker-1"},
+		Config:    BuildContainerConfig(containertypes.Config{}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}),
+	}}
+	assert.NotNil(t, containers.Get("web"))
+	assert.NotNil(t, containers.Get("/web"))
+	assert.NotNil(t, containers.Get("worker-1/web"))
+	assert.NotNil(t, containers.Get("worker-1-id/web"))
+	assert.Nil(t, containers.Get("worker-1web"))
+}
+
+func TestContainersSortBy(t *testing.T) {
+	containers := Containers{
+		{Container: types.Container{ID: "c", Created: 2}},
+		{Container: types.Container{ID: "b", Created: 1}},
+		{Container: types.Container{ID: "a", Created: 2}},
+	}
+
+	containers.SortBy(ByCreation)
+	assert.Equal(t, containers[0].ID, "b")
+	assert.Equal(t, containers[1].ID, "a")
+	assert.Equal(t, containers[2].ID, "c")
+
+	// Custom ordering, equal elements keep their relative order.
+	containers.SortBy(func(a, b *Container) bool { return a.Created > b.Created })
+	assert.Equal(t, containers[0].ID, "a")
+	assert.Equal(t, containers[1].ID, "c")
+	assert.Equal(t, containers[2].ID, "b")
+}
+
+func TestContainersFilterByHealth(t *testing.T) {
+	withHealth := func(id string, health *types.Health) *Container {
+		return &Container{
+			Container: types.Container{ID: id},
+			Info: types.ContainerJSON{
+				ContainerJSONBase: &types.ContainerJSONBase{
+					State: &types.ContainerState{Running: true, Health: health},
+				},
+			},
+		}
+	}
+	containers := Containers{
+		withHealth("healthy", &types.Health{Status: types.Healthy}),
+		withHealth("unhealthy", &types.Health{Status: types.Unhealthy}),
+		withHealth("starting", &types.Health{Status: types.Starting}),
+		withHealth("none", nil),
+		{Container: types.Container{ID: "unknown"}},
+	}
+
+	for _, status := range []string{types.Healthy, types.Unhealthy, types.Starting} {
+		filtered := containers.FilterByHealth(status)
+		assert.Len(t, filtered, 1)
+		assert.Equal(t, filtered[0].ID, status)
+	}
+
+	filtered := containers.FilterByHealth(types.NoHealthcheck)
+	assert.Len(t, filtered, 2)
+	assert.Equal(t, filtered[0].ID, "none")
+	assert.Equal(t, filtered[1].ID, "unknown")
+
+	assert.Empty(t, containers.FilterByHealth("invalid"))
+}
+
+func TestContainersFilterByState(t *testing.T) {
+	started := "2016-06-06T01:41:38.090313266Z"
+	states := []struct {
+		name  string
+		state *types.ContainerState
+	}{
+		{"running", &types.ContainerState{Running: true, StartedAt: started}},
+		{"paused", &types.ContainerState{Running: true, Paused: true, StartedAt: started}},
+		{"restarting", &types.ContainerState{Running: true, Restarting: true, StartedAt: started}},
+		{"dead", &types.ContainerState{Dead: true, StartedAt: started}},
+		{"created", &types.ContainerState{}},
+		{"exited", &types.ContainerState{StartedAt: started}},
+	}
+
+	// The container named after each state is in that state.
+	containers := Containers{{Container: types.Container{ID: "unknown"}}}
+	for _, s := range states {
+		containers = append(containers, &Container{
+			Container: types.Container{ID: s.name},
+			Info: types.ContainerJSON{
+				ContainerJSONBase: &types.ContainerJSONBase{State: s.state},
+			},
+		})
+	}
+
+	for _, s := range states {
+		filtered := containers.FilterByState(s.name)
+		assert.Len(t, filtered, 1)
+		assert.Equal(t, filtered[0].ID, s.name)
+	}
+	assert.Empty(t, containers.FilterByState("invalid"))
+}
+
+func TestContainerIsSwarmManaged(t *testing.T) {
+	managed := &Container{
+		Config: BuildContainerConfig(containertypes.Config{
+			Labels: map[string]string{
+				"com.docker.swarm.id": "swarm-id",
+			},
+		}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}),
+	}
+	assert.True(t, managed.IsSwarmManaged())
+
+	unmanaged := &Container{
+		Config: BuildContainerConfig(containertypes.Config{}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}),
+	}
+	assert.False(t, unmanaged.IsSwarmManaged())
+	assert.False(t, (&Container{}).IsSwarmManaged())
+}
+
+func TestContainersGetEngineQualifiedSwarmID(t *testing.T) {
+	container := func(engine *Engine, ID, swarmID string) *Container {
+		return &Container{
+			Container: types.Container{ID: ID},
+			Engine:    engine,
+			Config: BuildContainerConfig(containertypes.Config{
+				Labels: map[string]string{
+					"com.docker.swarm.id": swarmID,
+				},
+			}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}),
+		}
+	}
+	engine1 := &Engine{ID: "engine-1-id", Name: "worker-1"}
+	engine2 := &Engine{ID: "engine-2-id", Name: "worker-2"}
+
+	// Both swarm IDs have the same short form, abc123456789.
+	containers := Containers{
+		container(engine1, "container1-id", "abc123456789aaaa"),
+		container(engine2, "container2-id", "abc123456789bbbb"),
+	}
+
+	for _, IDOrName := range []string{
+		"worker-2/abc123456789",
+		"engine-2-id/abc123456789",
+		"worker-2/abc123456789bbbb",
+	} {
+		c := containers.Get(IDOrName)
+		assert.NotNil(t, c)
+		assert.Equal(t, c.ID, "container2-id")
+	}
+
+	c := containers.Get("worker-1/abc123456789")
+	assert.NotNil(t, c)
+	assert.Equal(t, c.ID, "container1-id")
+
+	assert.Nil(t, containers.Get("worker-3/abc123456789"))
+	assert.Nil(t, containers.Get("worker-1/abc123456789bbbb"))
+}
+
+func TestContainersFilterByLabel(t *testing.T) {
+	project := "com.docker.compose.project"
+	containers := Containers{
+		{Container: types.Container{ID: "web1", Labels: map[string]string{project: "web"}}},
+		{Container: types.Container{ID: "db1", Labels: map[string]string{project: "db"}}},
+		{Container: types.Container{ID: "web2", Labels: map[string]string{project: "web"}}},
+		{Container: types.Container{ID: "other"}},
+	}
+
+	web := containers.FilterByLabel(project, "web")
+	assert.Len(t, web, 2)
+	assert.Equal(t, "web1", web[0].ID)
+	assert.Equal(t, "web2", web[1].ID)
+
+	db := containers.FilterByLabel(project, "db")
+	assert.Len(t, db, 1)
+	assert.Equal(t, "db1", db[0].ID)
+
+	assert.Empty(t, containers.FilterByLabel(project, "cache"))
+	assert.Equal(t, []string{"db", "web"}, containers.LabelValues(project))
+	assert.Empty(t, containers.LabelValues("missing"))
+}
+
+func TestContainersFilterByPublishedPort(t *testing.T) {
+	containers := Containers{
+		{Container: types.Container{ID: "web-node1", Ports: []types.Port{{PrivatePort: 80, PublicPort: 8080, Type: "tcp"}}}, Engine: &Engine{ID: "node1"}},
+		{Container: types.Container{ID: "web-node2", Ports: []types.Port{{PrivatePort: 80, PublicPort: 8080, Type: "tcp"}}}, Engine: &Engine{ID: "node2"}},
+		{Container: types.Container{ID: "dns", Ports: []types.Port{{PrivatePort: 53, PublicPort: 53, Type: "udp"}, {PrivatePort: 53, PublicPort: 53, Type: "tcp"}}}},
+		{Container: types.Container{ID: "unpublished", Ports: []types.Port{{PrivatePort: 8080, Type: "tcp"}}}},
+	}
+
+	web := containers.FilterByPublishedPort(8080)
+	assert.Len(t, web, 2)
+	assert.Equal(t, "web-node1", web[0].ID)
+	assert.Equal(t, "web-node2", web[1].ID)
+
+	dns := containers.FilterByPublishedPort(53)
+	assert.Len(t, dns, 1)
+	assert.Equal(t, "dns", dns[0].ID)
+
+	assert.Empty(t, containers.FilterByPublishedPort(80))
 }
@@ -105,16 +105,27 @@ func (d *delayer) Wait(backoffFactor int) <-chan time.Time {
 	return time.After(time.Duration(waitPeriod))
 }
 
+// defaultRescheduleLoadWindow is used when EngineOpts leaves
+// RescheduleLoadWindow unset.
+const defaultRescheduleLoadWindow = time.Hour
+
 // EngineOpts represents the options for an engine
 type EngineOpts struct {
 	RefreshMinInterval time.Duration
 	RefreshMaxInterval time.Duration
 	FailureRetry       int
+	// RescheduleLoadWindow is how long a container rescheduled onto the
+	// engine counts towards its reschedule load.
+	RescheduleLoadWindow time.Duration
 }
 
 // Engine represents a docker engine
 type Engine struct {
 	sync.RWMutex
+	// connectLock serializes Connect and Disconnect, so an engine removed
+	// while it is still connecting is only torn down once the connection
+	// attempt has finished.
+	connectLock sync.Mutex
 
 	ID      string
 	IP      string
@@ -123,6 +134,7 @@ type Engine struct {
 	Cpus    int64
 	Memory  int64
 	Labels  map[string]string
+	Plugins types.PluginsInfo
 	Version string
 
 	stopCh          chan struct{}
@@ -142,6 +154,8 @@ type Engine struct {
 	overcommitRatio int64
 	opts            *EngineOpts
 	eventsMonitor   *EventsMonitor
+	cordoned        bool
+	rescheduledAt   []time.Time
 	DeltaDuration   time.Duration // swarm's systime - engine's systime
 }
 
@@ -176,6 +190,9 @@ func (e *Engine) HTTPClientAndScheme() (*http.Client, string, error) {
 // Connect will initialize a connection to the Docker daemon running on the
 // host, gather machine specs (memory, cpu, ...) and monitor state changes.
 func (e *Engine) Connect(config *tls.Config) error {
+	e.connectLock.Lock()
+	defer e.connectLock.Unlock()
+
 	host, _, err := net.SplitHostPort(e.Addr)
 	if err != nil {
 		return err
@@ -201,7 +218,7 @@ func (e *Engine) Connect(config *tls.Config) error {
 		return err
 	}
 
-	return e.ConnectWithClient(apiClient)
+	return e.connectWithClient(apiClient)
 }
 
 // StartMonitorEvents monitors events from the engine
@@ -234,8 +251,20 @@ func (e *Engine) StartMonitorEvents() {
 
 // ConnectWithClient is exported
 func (e *Engine) ConnectWithClient(apiClient swarmclient.SwarmAPIClient) error {
+	e.connectLock.Lock()
+	defer e.connectLock.Unlock()
+	return e.connectWithClient(apiClient)
+}
+
+func (e *Engine) connectWithClient(apiClient swarmclient.SwarmAPIClient) error {
+	e.Lock()
+	if e.state == stateDisconnected {
+		e.Unlock()
+		return fmt.Errorf("engine %s has been disconnected", e.Addr)
+	}
 	e.apiClient = apiClient
 	e.eventsMonitor = NewEventsMonitor(e.apiClient, e.handler)
+	e.Unlock()
 
 	// Fetch the engine labels.
 	if err := e.updateSpecs(); err != nil {
@@ -265,6 +294,8 @@ func (e *Engine) ConnectWithClient(apiClient swarmclient.SwarmAPIClient) error {
 // Disconnect will stop all monitoring of the engine.
 // The Engine object cannot be further used without reconnecting it first.
 func (e *Engine) Disconnect() {
+	e.connectLock.Lock()
+	defer e.connectLock.Unlock()
 	e.Lock()
 	defer e.Unlock()
 	// Resource clean up should be done only once
@@ -274,7 +305,10 @@ func (e *Engine) Disconnect() {
 
 	// close the chan
 	close(e.stopCh)
-	e.eventsMonitor.Stop()
+	// a pending engine may be removed before it ever connected
+	if e.eventsMonitor != nil {
+		e.eventsMonitor.Stop()
+	}
 
 	// close idle connections
 	if _, ok := e.apiClient.(*engineapi.Client); ok {
@@ -306,6 +340,75 @@ func (e *Engine) IsHealthy() bool {
 	return e.state == stateHealthy
 }
 
+// Cordon excludes the engine from the placement of new containers. The engine
+// is still monitored and reports its containers.
+func (e *Engine) Cordon() {
+	e.Lock()
+	defer e.Unlock()
+	e.cordoned = true
+}
+
+// Uncordon makes the engine available again for new containers.
+func (e *Engine) Uncordon() {
+	e.Lock()
+	defer e.Unlock()
+	e.cordoned = false
+}
+
+// IsCordoned returns true if the engine is cordoned
+func (e *Engine) IsCordoned() bool {
+	e.RLock()
+	defer e.RUnlock()
+	return e.cordoned
+}
+
+// RescheduleLoad returns the number of containers rescheduled onto the engine
+// within the reschedule load window.
+func (e *Engine) RescheduleLoad() int64 {
+	e.RLock()
+	defer e.RUnlock()
+	return int64(len(e.rescheduledAt) - e.expiredReschedules(time.Now()))
+}
+
+// incRescheduleLoad counts a container rescheduled onto the engine, and
+// forgets the ones which left the reschedule load window.
+func (e *Engine) incRescheduleLoad() {
+	e.Lock()
+	defer e.Unlock()
+	now := time.Now()
+	e.rescheduledAt = append(e.rescheduledAt[e.expiredReschedules(now):], now)
+}
+
+// expiredReschedules returns how many of the oldest reschedules fell out of
+// the reschedule load window at now. It must be called with the lock held.
+func (e *Engine) expiredReschedules(now time.Time) int {
+	window := e.opts.RescheduleLoadWindow
+	if window <= 0 {
+		window = defaultRescheduleLoadWindow
+	}
+	i := 0
+	for i < len(e.rescheduledAt) && now.Sub(e.rescheduledAt[i]) >= window {
+		i++
+	}
+	return i
+}
+
+// normalizeArch converts the architecture reported by the engine, as uname
+// prints it, to its GOARCH name, which is the one used by images.
+func normalizeArch(arch string) string {
+	switch arch = strings.ToLower(arch); arch {
+	case "x86_64", "x86-64":
+		return "amd64"
+	case "aarch64":
+		return "arm64"
+	case "i386", "i686":
+		return "386"
+	case "armhf", "armel", "armv6l", "armv7l":
+		return "arm"
+	}
+	return arch
+}
+
 // HealthIndicator returns degree of healthiness between 0 and 100.
 // 0 means node is not healthy (unhealthy, pending), 100 means last connectivity was successful
 // other values indicate recent failures but haven't moved engine out of healthy state
@@ -544,6 +647,8 @@ func (e *Engine) updateSpecs() error {
 	e.Cpus = int64(info.NCPU)
 	e.Memory = info.MemTotal
 
+	e.Plugins = info.Plugins
+
 	e.Labels = map[string]string{}
 	if info.Driver != "" {
 		e.Labels["storagedriver"] = info.Driver
@@ -556,6 +661,11 @@ func (e *Engine) updateSpecs() error {
 	}
 	if info.OSType != "" {
 		e.Labels["ostype"] = info.OSType
+		e.Labels["os"] = info.OSType
+	}
+	if info.Architecture != "" {
+		e.Labels["architecture"] = info.Architecture
+		e.Labels["arch"] = normalizeArch(info.Architecture)
 	}
 	for _, label := range info.Labels {
 		kv := strings.SplitN(label, "=", 2)
@@ -1083,12 +1193,43 @@ func (e *Engine) emitEvent(event string) {
 	e.eventHandler.Handle(ev)
 }
 
+// emitRescheduledEvent notifies that container replaces previous, a container
+// of the engine from, after a rescheduling.
+func (e *Engine) emitRescheduledEvent(container, previous *Container, from *Engine) {
+	// If there is no event handler registered, abort right now.
+	if e.eventHandler == nil {
+		return
+	}
+	ev := &Event{
+		Message: events.Message{
+			ID:     container.ID,
+			Status: "rescheduled",
+			From:   "swarm",
+			Type:   "container",
+			Action: "rescheduled",
+			Actor: events.Actor{
+				ID: container.ID,
+				Attributes: map[string]string{
+					SwarmLabelNamespace + ".id": container.Config.SwarmID(),
+					"node":                      e.ID,
+					"previous_node":             from.ID,
+					"previous_container":        previous.ID,
+				},
+			},
+			Time:     time.Now().Unix(),
+			TimeNano: time.Now().UnixNano(),
+		},
+		Engine: e,
+	}
+	e.eventHandler.Handle(ev)
+}
+
 // UsedMemory returns the sum of memory reserved by containers.
 func (e *Engine) UsedMemory() int64 {
 	var r int64
 	e.RLock()
 	for _, c := range e.containers {
-		r += c.Config.HostConfig.Memory
+		r += c.Config.RequestedMemory()
 	}
 	e.RUnlock()
 	return r
@@ -1099,7 +1240,7 @@ func (e *Engine) UsedCpus() int64 {
 	var r int64
 	e.RLock()
 	for _, c := range e.containers {
-		r += c.Config.HostConfig.CPUShares
+		r += c.Config.RequestedCPUShares()
 	}
 	e.RUnlock()
 	return r
@@ -1165,6 +1306,46 @@ func (e *Engine) CreateContainer(config *ContainerConfig, name string, pullImage
 	return container, err
 }
 
+// StopContainer stops a container, giving it timeout to exit before it is
+// killed by the daemon.
+func (e *Engine) StopContainer(container *Container, timeout *time.Duration) error {
+	err := e.apiClient.ContainerStop(context.Background(), container.ID, timeout)
+	e.CheckConnectionErr(err)
+	if err != nil {
+		return err
+	}
+
+	// refresh the container in the cache
+	_, err = e.refreshContainer(container.ID, true)
+	return err
+}
+
+// PauseContainer pauses a container
+func (e *Engine) PauseContainer(container *Container) error {
+	err := e.apiClient.ContainerPause(context.Background(), container.ID)
+	e.CheckConnectionErr(err)
+	if err != nil {
+		return err
+	}
+
+	// refresh the container in the cache
+	_, err = e.refreshContainer(container.ID, true)
+	return err
+}
+
+// UnpauseContainer unpauses a container
+func (e *Engine) UnpauseContainer(container *Container) error {
+	err := e.apiClient.ContainerUnpause(context.Background(), container.ID)
+	e.CheckConnectionErr(err)
+	if err != nil {
+		return err
+	}
+
+	// refresh the container in the cache
+	_, err = e.refreshContainer(container.ID, true)
+	return err
+}
+
 // RemoveContainer removes a container from the engine.
 func (e *Engine) RemoveContainer(container *Container, force, volumes bool) error {
 	opts := types.ContainerRemoveOptions{
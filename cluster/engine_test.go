@@ -32,7 +32,12 @@ var (
 		KernelVersion:   "1.2.3",
 		OperatingSystem: "golang",
 		OSType:          "linux",
+		Architecture:    "x86_64",
 		Labels:          []string{"foo=bar"},
+		Plugins: types.PluginsInfo{
+			Volume:  []string{"local", "rexray"},
+			Network: []string{"bridge", "overlay"},
+		},
 	}
 
 	mockVersion = types.Version{
@@ -215,7 +220,11 @@ func TestEngineSpecs(t *testing.T) {
 	assert.Equal(t, engine.Labels["kernelversion"], mockInfo2.KernelVersion)
 	assert.Equal(t, engine.Labels["operatingsystem"], mockInfo2.OperatingSystem)
 	assert.Equal(t, engine.Labels["ostype"], mockInfo2.OSType)
+	assert.Equal(t, engine.Labels["architecture"], mockInfo2.Architecture)
+	assert.Equal(t, engine.Labels["os"], "linux")
+	assert.Equal(t, engine.Labels["arch"], "amd64")
 	assert.Equal(t, engine.Labels["foo"], "bar")
+	assert.Equal(t, engine.Plugins, mockInfo2.Plugins)
 
 	assert.NotEqual(t, engine.Labels["node"], "node1")
 
@@ -524,6 +533,43 @@ func TestCreateContainer(t *testing.T) {
 	assert.Len(t, engine.Containers(), 2)
 }
 
+func TestCreateContainerEscapedEnv(t *testing.T) {
+	engine := NewEngine("test", 0, engOpts)
+	engine.Cpus = 1
+	apiClient := engineapimock.NewMockClient()
+	engine.apiClient = apiClient
+
+	config := BuildContainerConfig(containertypes.Config{
+		Image: "busybox",
+		Env:   []string{`\affinity:container==db`, "constraint:region==us-east"},
+	}, containertypes.HostConfig{}, networktypes.NetworkingConfig{})
+
+	// the engine is given the escaped env var, and reports it back on inspect
+	apiClient.On("ContainerCreate", mock.Anything, &config.Config, mock.Anything, mock.Anything, "test").Return(containertypes.ContainerCreateCreatedBody{ID: "id"}, nil).Once()
+	apiClient.On("ContainerList", mock.Anything, mock.AnythingOfType("ContainerListOptions")).Return([]types.Container{{ID: "id"}}, nil)
+	apiClient.On("ContainerInspect", mock.Anything, "id").Return(types.ContainerJSON{
+		Config: &config.Config,
+		ContainerJSONBase: &types.ContainerJSONBase{
+			HostConfig: &config.HostConfig,
+			State:      &types.ContainerState{},
+		},
+		NetworkSettings: &types.NetworkSettings{},
+	}, nil)
+
+	container, err := engine.CreateContainer(config, "test", false, nil)
+	assert.NoError(t, err)
+
+	// the escaped env var is still an env var once rebuilt from inspect
+	assert.Equal(t, []string{"affinity:container==db"}, container.Config.Env)
+	assert.Empty(t, container.Config.Affinities())
+	assert.Equal(t, []string{"region==us-east"}, container.Config.Constraints())
+
+	// and stays one however many times the config is rebuilt
+	rebuilt := BuildContainerConfig(container.Config.Config, container.Config.HostConfig, container.Config.NetworkingConfig)
+	assert.Equal(t, container.Config.Env, rebuilt.Env)
+	assert.Equal(t, container.Config.Labels, rebuilt.Labels)
+}
+
 func TestImages(t *testing.T) {
 	engine := NewEngine("test", 0, engOpts)
 	engine.setState(stateHealthy)
@@ -798,6 +844,11 @@ func TestDisconnect(t *testing.T) {
 	assert.True(t, engine.state == stateDisconnected)
 	// Double disconnect shouldn't cause panic
 	engine.Disconnect()
+
+	// Disconnecting an engine that never connected shouldn't cause panic
+	engine = NewEngine("test", 0, engOpts)
+	engine.Disconnect()
+	assert.True(t, engine.state == stateDisconnected)
 }
 
 func TestRemoveImage(t *testing.T) {
@@ -906,3 +957,75 @@ func TestRefreshLoop(t *testing.T) {
 	time.Sleep(1 * time.Second)
 	assert.Len(t, engine.Containers(), 1)
 }
+
+func TestEmitRescheduledEvent(t *testing.T) {
+	oldEngine := NewEngine("old-engine", 0, engOpts)
+	oldEngine.ID = "old-engine-id"
+	newEngine := NewEngine("new-engine", 0, engOpts)
+	newEngine.ID = "new-engine-id"
+
+	handler := &recordingHandler{}
+	assert.NoError(t, newEngine.RegisterEventHandler(handler))
+
+	config := BuildContainerConfig(containertypes.Config{}, containertypes.HostConfig{}, networktypes.NetworkingConfig{})
+	config.SetSwarmID("swarm-id")
+	previous := &Container{Container: types.Container{ID: "old-container-id"}, Config: config, Engine: oldEngine}
+	container := &Container{Container: types.Container{ID: "new-container-id"}, Config: config, Engine: newEngine}
+
+	newEngine.emitRescheduledEvent(container, previous, oldEngine)
+
+	assert.Len(t, handler.events, 1)
+	e := handler.events[0]
+	assert.Equal(t, "rescheduled", e.Status)
+	assert.Equal(t, "swarm", e.From)
+	assert.Equal(t, "new-container-id", e.Actor.ID)
+	assert.Equal(t, newEngine, e.Engine)
+	assert.Equal(t, map[string]string{
+		"com.docker.swarm.id": "swarm-id",
+		"node":                "new-engine-id",
+		"previous_node":       "old-engine-id",
+		"previous_container":  "old-container-id",
+	}, e.Actor.Attributes)
+}
+
+func TestRescheduleLoadWindow(t *testing.T) {
+	engine := NewEngine("test", 0, &EngineOpts{
+		RefreshMinInterval:   engOpts.RefreshMinInterval,
+		RefreshMaxInterval:   engOpts.RefreshMaxInterval,
+		FailureRetry:         engOpts.FailureRetry,
+		RescheduleLoadWindow: time.Minute,
+	})
+	assert.Equal(t, int64(0), engine.RescheduleLoad())
+
+	engine.incRescheduleLoad()
+	engine.incRescheduleLoad()
+	assert.Equal(t, int64(2), engine.RescheduleLoad())
+
+	// the first reschedule leaves the window
+	engine.rescheduledAt[0] = time.Now().Add(-2 * time.Minute)
+	assert.Equal(t, int64(1), engine.RescheduleLoad())
+
+	// and is forgotten on the next one
+	engine.incRescheduleLoad()
+	assert.Len(t, engine.rescheduledAt, 2)
+	assert.Equal(t, int64(2), engine.RescheduleLoad())
+
+	// the default window applies when none is set
+	engine.opts.RescheduleLoadWindow = 0
+	engine.rescheduledAt[0] = time.Now().Add(-defaultRescheduleLoadWindow)
+	assert.Equal(t, int64(1), engine.RescheduleLoad())
+}
+
+func TestNormalizeArch(t *testing.T) {
+	for arch, expected := range map[string]string{
+		"x86_64":  "amd64",
+		"amd64":   "amd64",
+		"aarch64": "arm64",
+		"i686":    "386",
+		"armv7l":  "arm",
+		"ppc64le": "ppc64le",
+		"s390x":   "s390x",
+	} {
+		assert.Equal(t, expected, normalizeArch(arch))
+	}
+}
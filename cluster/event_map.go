@@ -7,16 +7,22 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-// ClusterEventHandlers is a map of EventHandler
+// ClusterEventHandlers is a map of EventHandler to an optional EventFilter
 type ClusterEventHandlers struct {
 	sync.RWMutex
-	eventHandlers map[EventHandler]struct{}
+	eventHandlers map[EventHandler]*EventFilter
+
+	// replay holds the most recent events, up to replaySize, for the
+	// handlers registered with RegisterEventHandlerWithReplay.
+	replayLock sync.Mutex
+	replay     []*Event
+	replaySize int
 }
 
 // NewClusterEventHandlers initializes and returns a ClusterEventHandlers object
 func NewClusterEventHandlers() ClusterEventHandlers {
 	return ClusterEventHandlers{
-		eventHandlers: make(map[EventHandler]struct{}),
+		eventHandlers: make(map[EventHandler]*EventFilter),
 	}
 }
 
@@ -25,7 +31,12 @@ func (eh *ClusterEventHandlers) Handle(e *Event) error {
 	eh.RLock()
 	defer eh.RUnlock()
 
-	for h := range eh.eventHandlers {
+	eh.record(e)
+
+	for h, f := range eh.eventHandlers {
+		if f != nil && !f.Match(e) {
+			continue
+		}
 		if err := h.Handle(e); err != nil {
 			log.Error(err)
 		}
@@ -35,16 +46,86 @@ func (eh *ClusterEventHandlers) Handle(e *Event) error {
 
 // RegisterEventHandler registers an event handler.
 func (eh *ClusterEventHandlers) RegisterEventHandler(h EventHandler) error {
+	return eh.register(h, nil)
+}
+
+// RegisterFilteredEventHandler registers an event handler which only
+// receives the events matching the filter.
+func (eh *ClusterEventHandlers) RegisterFilteredEventHandler(f EventFilter, h EventHandler) error {
+	return eh.register(h, &f)
+}
+
+func (eh *ClusterEventHandlers) register(h EventHandler, f *EventFilter) error {
 	eh.Lock()
 	defer eh.Unlock()
 
 	if _, ok := eh.eventHandlers[h]; ok {
 		return errors.New("event handler already set")
 	}
-	eh.eventHandlers[h] = struct{}{}
+	eh.eventHandlers[h] = f
 	return nil
 }
 
+// RegisterEventHandlerWithReplay registers an event handler and passes it the
+// recent events kept in the replay buffer. The replay happens without holding
+// the locks, so that the handler may unregister itself, and new events may
+// reach the handler while it is in progress.
+func (eh *ClusterEventHandlers) RegisterEventHandlerWithReplay(h EventHandler) error {
+	eh.Lock()
+	if _, ok := eh.eventHandlers[h]; ok {
+		eh.Unlock()
+		return errors.New("event handler already set")
+	}
+	eh.eventHandlers[h] = nil
+
+	eh.replayLock.Lock()
+	replay := make([]*Event, len(eh.replay))
+	copy(replay, eh.replay)
+	eh.replayLock.Unlock()
+	eh.Unlock()
+
+	for _, e := range replay {
+		// stop once the handler is gone
+		eh.RLock()
+		_, ok := eh.eventHandlers[h]
+		eh.RUnlock()
+		if !ok {
+			break
+		}
+		if err := h.Handle(e); err != nil {
+			log.Error(err)
+		}
+	}
+	return nil
+}
+
+// SetReplayBufferSize sets the number of recent events kept for
+// RegisterEventHandlerWithReplay. 0, the default, keeps none.
+func (eh *ClusterEventHandlers) SetReplayBufferSize(size int) {
+	eh.replayLock.Lock()
+	defer eh.replayLock.Unlock()
+
+	eh.replaySize = size
+	if len(eh.replay) > size {
+		eh.replay = eh.replay[len(eh.replay)-size:]
+	}
+}
+
+// record adds an event to the replay buffer, dropping the oldest one when
+// the buffer is full.
+func (eh *ClusterEventHandlers) record(e *Event) {
+	eh.replayLock.Lock()
+	defer eh.replayLock.Unlock()
+
+	if eh.replaySize <= 0 {
+		return
+	}
+	if len(eh.replay) >= eh.replaySize {
+		eh.replay = append(eh.replay[:0], eh.replay[len(eh.replay)-eh.replaySize+1:]...)
+	}
+	eh.replay = append(eh.replay, e)
+}
+
 // UnregisterEventHandler unregisters a previously registered event handler.
 func (eh *ClusterEventHandlers) UnregisterEventHandler(h EventHandler) {
 	eh.Lock()
@@ -0,0 +1,150 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingHandler struct {
+	events []*Event
+}
+
+func (h *recordingHandler) Handle(e *Event) error {
+	h.events = append(h.events, e)
+	return nil
+}
+
+// unregisteringHandler unregisters itself from the first event it handles.
+type unregisteringHandler struct {
+	recordingHandler
+	eh *ClusterEventHandlers
+}
+
+func (h *unregisteringHandler) Handle(e *Event) error {
+	h.eh.UnregisterEventHandler(h)
+	return h.recordingHandler.Handle(e)
+}
+
+func newTestEvent(engine *Engine, containerID, status string) *Event {
+	return &Event{
+		Message: events.Message{
+			ID:     containerID,
+			Status: status,
+			Actor:  events.Actor{ID: containerID},
+		},
+		Engine: engine,
+	}
+}
+
+func TestEventFilter(t *testing.T) {
+	engine1 := &Engine{ID: "engine-1"}
+	engine2 := &Engine{ID: "engine-2"}
+
+	f := EventFilter{}
+	assert.True(t, f.Match(newTestEvent(engine1, "container-1", "start")))
+
+	f = EventFilter{EngineID: "engine-1"}
+	assert.True(t, f.Match(newTestEvent(engine1, "container-1", "start")))
+	assert.False(t, f.Match(newTestEvent(engine2, "container-1", "start")))
+
+	f = EventFilter{ContainerID: "container-1"}
+	assert.True(t, f.Match(newTestEvent(engine1, "container-1", "start")))
+	assert.False(t, f.Match(newTestEvent(engine1, "container-2", "start")))
+
+	f = EventFilter{EngineID: "engine-1", Status: "die"}
+	assert.True(t, f.Match(newTestEvent(engine1, "container-1", "die")))
+	assert.False(t, f.Match(newTestEvent(engine1, "container-1", "start")))
+	assert.False(t, f.Match(newTestEvent(engine2, "container-1", "die")))
+}
+
+func TestRegisterFilteredEventHandler(t *testing.T) {
+	engine1 := &Engine{ID: "engine-1"}
+	engine2 := &Engine{ID: "engine-2"}
+
+	eh := NewClusterEventHandlers()
+	all := &recordingHandler{}
+	scoped := &recordingHandler{}
+	assert.NoError(t, eh.RegisterEventHandler(all))
+	assert.NoError(t, eh.RegisterFilteredEventHandler(EventFilter{EngineID: "engine-1"}, scoped))
+	assert.Error(t, eh.RegisterFilteredEventHandler(EventFilter{}, scoped))
+
+	eh.Handle(newTestEvent(engine1, "container-1", "start"))
+	eh.Handle(newTestEvent(engine2, "container-2", "start"))
+	eh.Handle(newTestEvent(engine1, "container-3", "die"))
+
+	assert.Len(t, all.events, 3)
+	assert.Len(t, scoped.events, 2)
+	for _, e := range scoped.events {
+		assert.Equal(t, e.Engine.ID, "engine-1")
+	}
+
+	eh.UnregisterEventHandler(scoped)
+	eh.Handle(newTestEvent(engine1, "container-1", "stop"))
+	assert.Len(t, all.events, 4)
+	assert.Len(t, scoped.events, 2)
+}
+
+func TestRegisterEventHandlerWithReplay(t *testing.T) {
+	engine := &Engine{ID: "engine-1"}
+
+	eh := NewClusterEventHandlers()
+	eh.SetReplayBufferSize(2)
+	eh.Handle(newTestEvent(engine, "container-1", "create"))
+	eh.Handle(newTestEvent(engine, "container-1", "start"))
+	eh.Handle(newTestEvent(engine, "container-1", "die"))
+
+	// Only the last 2 events are replayed, oldest first.
+	late := &recordingHandler{}
+	assert.NoError(t, eh.RegisterEventHandlerWithReplay(late))
+	assert.Len(t, late.events, 2)
+	assert.Equal(t, "start", late.events[0].Status)
+	assert.Equal(t, "die", late.events[1].Status)
+	assert.Error(t, eh.RegisterEventHandlerWithReplay(late))
+
+	// New events follow the replayed ones.
+	eh.Handle(newTestEvent(engine, "container-1", "destroy"))
+	assert.Len(t, late.events, 3)
+	assert.Equal(t, "destroy", late.events[2].Status)
+
+	// Handlers registered without replay only get new events.
+	other := &recordingHandler{}
+	assert.NoError(t, eh.RegisterEventHandler(other))
+	assert.Empty(t, other.events)
+
+	// Without a buffer, nothing is replayed.
+	eh = NewClusterEventHandlers()
+	eh.Handle(newTestEvent(engine, "container-1", "start"))
+	late = &recordingHandler{}
+	assert.NoError(t, eh.RegisterEventHandlerWithReplay(late))
+	assert.Empty(t, late.events)
+}
+
+func TestReplayUnregisteringHandler(t *testing.T) {
+	engine := &Engine{ID: "engine-1"}
+
+	eh := NewClusterEventHandlers()
+	eh.SetReplayBufferSize(2)
+	eh.Handle(newTestEvent(engine, "container-1", "create"))
+	eh.Handle(newTestEvent(engine, "container-1", "start"))
+
+	h := &unregisteringHandler{eh: &eh}
+	done := make(chan error)
+	go func() {
+		done <- eh.RegisterEventHandlerWithReplay(h)
+	}()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the replay is blocked by the handler unregistering itself")
+	}
+
+	// the replay stops once the handler is gone
+	assert.Len(t, h.events, 1)
+	assert.Equal(t, "create", h.events[0].Status)
+	eh.Handle(newTestEvent(engine, "container-1", "die"))
+	assert.Len(t, h.events, 1)
+}
@@ -18,3 +18,28 @@ type EventHandler interface {
 // - Watchdog: Handles events related to rescheduling
 // - Cluster: Acts as a proxy event handler for the engine, but essentially
 // punts all handling to the above two handlers
+
+// EventFilter restricts the events passed to an EventHandler.
+// Empty fields match any event.
+type EventFilter struct {
+	// EngineID matches the ID of the engine emitting the event.
+	EngineID string
+	// ContainerID matches the ID of the container the event is about.
+	ContainerID string
+	// Status matches the event status (or action).
+	Status string
+}
+
+// Match returns true if the event passes the filter.
+func (f *EventFilter) Match(e *Event) bool {
+	if f.EngineID != "" && (e.Engine == nil || e.Engine.ID != f.EngineID) {
+		return false
+	}
+	if f.ContainerID != "" && e.ID != f.ContainerID && e.Actor.ID != f.ContainerID {
+		return false
+	}
+	if f.Status != "" && e.Status != f.Status && e.Action != f.Status {
+		return false
+	}
+	return true
+}
@@ -1,6 +1,8 @@
 package cluster
 
 import (
+	"path"
+	"strconv"
 	"strings"
 
 	"github.com/docker/distribution/reference"
@@ -34,6 +36,18 @@ func ParseRepositoryTag(repos string) (string, string) {
 	return repos, ""
 }
 
+// NormalizeImageRef returns the shortest form of an image reference, so that
+// different spellings of the same image compare equal.
+//     Ex: docker.io/library/nginx:latest, library/nginx:latest -> nginx:latest
+// References which can't be parsed, such as image IDs, are returned unchanged.
+func NormalizeImageRef(ref string) string {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return ref
+	}
+	return reference.FamiliarString(named)
+}
+
 // Match is exported
 func (image *Image) Match(IDOrName string, matchTag bool) bool {
 	size := len(IDOrName)
@@ -51,15 +65,17 @@ func (image *Image) Match(IDOrName string, matchTag bool) bool {
 	}
 
 	repoName, tag := ParseRepositoryTag(IDOrName)
+	repoName = NormalizeImageRef(repoName)
 
 	// match repotag
 	for _, imageRepoTag := range image.RepoTags {
 		imageRepoName, imageTag := ParseRepositoryTag(imageRepoTag)
+		imageRepoName = NormalizeImageRef(imageRepoName)
 
 		if matchTag == false && imageRepoName == repoName {
 			return true
 		}
-		if imageRepoName == repoName && (imageTag == tag || tag == "") {
+		if imageRepoName == repoName && (imageTag == tag || tag == "" || matchTagGlob(tag, imageTag)) {
 			return true
 		}
 	}
@@ -67,6 +83,7 @@ func (image *Image) Match(IDOrName string, matchTag bool) bool {
 	// match repodigests
 	for _, imageDigest := range image.RepoDigests {
 		imageRepoName, imageDigest := ParseRepositoryTag(imageDigest)
+		imageRepoName = NormalizeImageRef(imageRepoName)
 
 		if matchTag == false && imageRepoName == repoName {
 			return true
@@ -78,6 +95,16 @@ func (image *Image) Match(IDOrName string, matchTag bool) bool {
 	return false
 }
 
+// matchTagGlob returns true if pattern has wildcards (*, ? or [...]) and
+// matches tag (ex. 1.* matches 1.21 but not 2.0).
+func matchTagGlob(pattern, tag string) bool {
+	if !strings.ContainsAny(pattern, "*?[") {
+		return false
+	}
+	matched, err := path.Match(pattern, tag)
+	return err == nil && matched
+}
+
 // ImageFilterOptions is the set of filtering options supported by
 // Images.Filter()
 type ImageFilterOptions struct {
@@ -87,6 +114,32 @@ type ImageFilterOptions struct {
 // Images is a collection of Image objects that can be filtered
 type Images []*Image
 
+// Uniq returns the images without duplicates, an image being present on
+// several engines. The first image with a given ID is kept.
+func (images Images) Uniq() Images {
+	seen := make(map[string]bool)
+	uniq := Images{}
+	for _, image := range images {
+		if !seen[image.ID] {
+			seen[image.ID] = true
+			uniq = append(uniq, image)
+		}
+	}
+	return uniq
+}
+
+// EngineIDs returns the IDs of the engines holding each image, indexed by
+// image ID.
+func (images Images) EngineIDs() map[string][]string {
+	engines := make(map[string][]string)
+	for _, image := range images {
+		if image.Engine != nil {
+			engines[image.ID] = append(engines[image.ID], image.Engine.ID)
+		}
+	}
+	return engines
+}
+
 // Filter returns a new sequence of Images filtered to only the images that
 // matched the filtering parameters
 func (images Images) Filter(opts ImageFilterOptions) Images {
@@ -175,16 +228,54 @@ func (images Images) Filter(opts ImageFilterOptions) Images {
 		return true
 	}
 
+	sizeFilter := func(image *Image) bool {
+		// every size condition must be met, which allows ranges
+		// (ex. size=>1000 and size=<2000)
+		for _, value := range opts.Filters.Get("size") {
+			if !matchSize(value, image.Size) {
+				return false
+			}
+		}
+		return true
+	}
+
 	filtered := make([]*Image, 0, len(images))
 	for _, image := range images {
 		if includeAll(image) && includeFilter(image) && referenceFilter(image, "reference") && danglingFilter(image) &&
-			beforeFilter(image, beforeFilterImage) && sinceFilter(image, sinceFilterImage) {
+			beforeFilter(image, beforeFilterImage) && sinceFilter(image, sinceFilterImage) && sizeFilter(image) {
 			filtered = append(filtered, image)
 		}
 	}
 	return filtered
 }
 
+// matchSize returns true if size meets condition, a number of bytes optionally
+// prefixed by one of >, <, >=, <= or =. An invalid condition matches nothing.
+func matchSize(condition string, size int64) bool {
+	operator := ""
+	for _, op := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(condition, op) {
+			operator = op
+			break
+		}
+	}
+	value, err := strconv.ParseInt(strings.TrimPrefix(condition, operator), 10, 64)
+	if err != nil {
+		return false
+	}
+	switch operator {
+	case ">=":
+		return size >= value
+	case "<=":
+		return size <= value
+	case ">":
+		return size > value
+	case "<":
+		return size < value
+	}
+	return size == value
+}
+
 // GetIDOrName is a helper func for filtering
 func (opts ImageFilterOptions) GetIDOrName(field string) string {
 	if !opts.Filters.Include(field) {
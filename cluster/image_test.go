@@ -40,6 +40,27 @@ func TestMatch(t *testing.T) {
 	assert.False(t, img.Match("name@sha256:111111415c489a934bf56dd653079d36b4ec717760215645726439de9705911d", true))
 }
 
+func TestMatchTagGlob(t *testing.T) {
+	images := []*Image{}
+	for _, tag := range []string{"nginx:1.21", "nginx:1.25", "nginx:2.0"} {
+		img := &Image{}
+		img.ID = "sha256:" + tag
+		img.RepoTags = []string{tag}
+		images = append(images, img)
+	}
+
+	assert.True(t, images[0].Match("nginx:1.*", true))
+	assert.True(t, images[1].Match("nginx:1.*", true))
+	assert.False(t, images[2].Match("nginx:1.*", true))
+
+	assert.True(t, images[0].Match("nginx:1.2?", true))
+	assert.True(t, images[2].Match("nginx:[23].0", true))
+	assert.False(t, images[0].Match("redis:1.*", true))
+
+	// an invalid pattern matches nothing
+	assert.False(t, images[0].Match("nginx:1.[", true))
+}
+
 func TestMatchPrivateRepo(t *testing.T) {
 	img := Image{}
 
@@ -56,6 +77,57 @@ func TestMatchPrivateRepo(t *testing.T) {
 	assert.False(t, img.Match("private.registry.com:5000/na", false))
 }
 
+func TestNormalizeImageRef(t *testing.T) {
+	assert.Equal(t, NormalizeImageRef("nginx"), "nginx")
+	assert.Equal(t, NormalizeImageRef("library/nginx"), "nginx")
+	assert.Equal(t, NormalizeImageRef("docker.io/library/nginx"), "nginx")
+	assert.Equal(t, NormalizeImageRef("docker.io/library/nginx:1.13"), "nginx:1.13")
+	assert.Equal(t, NormalizeImageRef("docker.io/samalba/hipache"), "samalba/hipache")
+	assert.Equal(t, NormalizeImageRef("private.registry.com:5000/name:latest"), "private.registry.com:5000/name:latest")
+	// Unparsable references are left alone.
+	assert.Equal(t, NormalizeImageRef("378954456789"), "378954456789")
+	assert.Equal(t, NormalizeImageRef("Invalid"), "Invalid")
+}
+
+func TestMatchOfficialImage(t *testing.T) {
+	img := Image{}
+
+	img.ID = "378954456789"
+	img.RepoTags = []string{"nginx:latest"}
+
+	for _, name := range []string{"nginx", "library/nginx", "docker.io/library/nginx"} {
+		assert.True(t, img.Match(name, true))
+		assert.True(t, img.Match(name+":latest", true))
+		assert.False(t, img.Match(name+":alpine", true))
+		assert.True(t, img.Match(name+":alpine", false))
+	}
+
+	// And the other way around.
+	img.RepoTags = []string{"docker.io/library/nginx:latest"}
+	assert.True(t, img.Match("nginx:latest", true))
+	assert.False(t, img.Match("other/nginx", false))
+}
+
+func TestImagesUniq(t *testing.T) {
+	engine1 := &Engine{ID: "engine-1"}
+	engine2 := &Engine{ID: "engine-2"}
+	images := Images{
+		{ImageSummary: types.ImageSummary{ID: "image-1", RepoTags: []string{"nginx:latest"}}, Engine: engine1},
+		{ImageSummary: types.ImageSummary{ID: "image-2", RepoTags: []string{"redis:latest"}}, Engine: engine1},
+		{ImageSummary: types.ImageSummary{ID: "image-1", RepoTags: []string{"nginx:latest"}}, Engine: engine2},
+	}
+
+	uniq := images.Uniq()
+	assert.Len(t, uniq, 2)
+	assert.Equal(t, uniq[0].ID, "image-1")
+	assert.Equal(t, uniq[1].ID, "image-2")
+
+	engines := images.EngineIDs()
+	assert.Len(t, engines, 2)
+	assert.Equal(t, engines["image-1"], []string{"engine-1", "engine-2"})
+	assert.Equal(t, engines["image-2"], []string{"engine-1"})
+}
+
 func TestImagesFilterWithLabelFilter(t *testing.T) {
 	engine := NewEngine("test", 0, engOpts)
 	images := Images{
@@ -250,3 +322,34 @@ func TestParseRepositoryTag(t *testing.T) {
 		t.Logf("repo=%s tag=%s", repo, tag)
 	}
 }
+
+func TestImageFilterWithSize(t *testing.T) {
+	engine := NewEngine("test", 0, engOpts)
+	images := Images{
+		{types.ImageSummary{ID: "small", RepoTags: []string{"small:latest"}, Size: 1000}, engine},
+		{types.ImageSummary{ID: "medium", RepoTags: []string{"medium:latest"}, Size: 5000}, engine},
+		{types.ImageSummary{ID: "large", RepoTags: []string{"large:latest"}, Size: 9000}, engine},
+	}
+
+	filter := func(values ...string) []string {
+		args := dockerfilters.NewArgs()
+		for _, value := range values {
+			args.Add("size", value)
+		}
+		ids := []string{}
+		for _, image := range images.Filter(ImageFilterOptions{types.ImageListOptions{Filters: args}}) {
+			ids = append(ids, image.ID)
+		}
+		return ids
+	}
+
+	assert.Equal(t, []string{"small", "medium", "large"}, filter())
+	assert.Equal(t, []string{"large"}, filter(">5000"))
+	assert.Equal(t, []string{"medium", "large"}, filter(">=5000"))
+	assert.Equal(t, []string{"small"}, filter("<5000"))
+	assert.Equal(t, []string{"small", "medium"}, filter("<=5000"))
+	assert.Equal(t, []string{"medium"}, filter("5000"))
+	assert.Equal(t, []string{"medium"}, filter("=5000"))
+	assert.Equal(t, []string{"medium"}, filter(">1000", "<9000"))
+	assert.Empty(t, filter(">big"))
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -23,6 +24,7 @@ import (
 	"github.com/docker/swarm/api"
 	"github.com/docker/swarm/cluster"
 	"github.com/docker/swarm/scheduler"
+	"github.com/docker/swarm/scheduler/filter"
 	"github.com/docker/swarm/scheduler/node"
 	log "github.com/sirupsen/logrus"
 )
@@ -71,6 +73,14 @@ type Cluster struct {
 	engineOpts      *cluster.EngineOpts
 	createRetry     int64
 	TLSConfig       *tls.Config
+
+	// generateID generates the candidates for swarm IDs,
+	// stringid.GenerateRandomID when nil. See SetIDGenerator.
+	generateID func() string
+
+	// connectSlots bounds the number of engines connecting at the same
+	// time, nil when unbounded.
+	connectSlots chan struct{}
 }
 
 // NewCluster is exported.
@@ -91,22 +101,46 @@ func NewCluster(scheduler *scheduler.Scheduler, TLSConfig *tls.Config, discovery
 		builds:               newBuildSyncer(),
 	}
 
-	if val, ok := options.Float("swarm.overcommit", ""); ok {
-		if val <= float64(-1) {
-			log.Fatalf("swarm.overcommit should be larger than -1, %f is invalid", val)
-		} else if val < float64(0) {
+	if val, ok := options.String("swarm.overcommit", ""); ok {
+		ratio, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return nil, fmt.Errorf("swarm.overcommit should be a number, %q is invalid", val)
+		}
+		if ratio <= float64(-1) {
+			return nil, fmt.Errorf("swarm.overcommit should be larger than -1, %f is invalid", ratio)
+		} else if ratio < float64(0) {
 			log.Warn("-1 < swarm.overcommit < 0 will make swarm take less resource than docker engine offers")
-			cluster.overcommitRatio = val
-		} else {
-			cluster.overcommitRatio = val
 		}
+		cluster.overcommitRatio = ratio
 	}
 
-	if val, ok := options.Int("swarm.createretry", ""); ok {
-		if val < 0 {
-			log.Fatalf("swarm.createretry can not be negative, %d is invalid", val)
+	if val, ok := options.String("swarm.createretry", ""); ok {
+		retries, err := strconv.ParseInt(val, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("swarm.createretry should be an integer, %q is invalid", val)
+		}
+		if retries < 0 {
+			return nil, fmt.Errorf("swarm.createretry can not be negative, %d is invalid", retries)
 		}
-		cluster.createRetry = val
+		cluster.createRetry = retries
+	}
+
+	if val, ok := options.String("swarm.maxconcurrentconnects", ""); ok {
+		max, err := strconv.ParseInt(val, 0, 64)
+		if err != nil || max < 0 {
+			return nil, fmt.Errorf("swarm.maxconcurrentconnects should be a non-negative integer, %q is invalid", val)
+		}
+		if max > 0 {
+			cluster.connectSlots = make(chan struct{}, max)
+		}
+	}
+
+	if val, ok := options.String("swarm.eventbuffersize", ""); ok {
+		size, err := strconv.ParseInt(val, 0, 64)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("swarm.eventbuffersize should be a non-negative integer, %q is invalid", val)
+		}
+		cluster.SetReplayBufferSize(int(size))
 	}
 
 	discoveryCh, errCh := cluster.discovery.Watch(nil)
@@ -121,14 +155,34 @@ func (c *Cluster) NewAPIEventHandler() *cluster.APIEventHandler {
 	return cluster.NewAPIEventHandler()
 }
 
+// maxIDAttempts is the number of IDs generateUniqueID tries before giving up.
+const maxIDAttempts = 10
+
+// SetIDGenerator replaces the function generating the candidates for swarm
+// IDs, for instance to get predictable IDs. A nil generate restores the
+// default random IDs. Candidates already in use in the cluster are skipped.
+func (c *Cluster) SetIDGenerator(generate func() string) {
+	c.Lock()
+	defer c.Unlock()
+	c.generateID = generate
+}
+
 // generateUniqueID generates a globally (across the cluster) unique ID.
-func (c *Cluster) generateUniqueID() string {
-	for {
-		id := stringid.GenerateRandomID()
+func (c *Cluster) generateUniqueID() (string, error) {
+	c.RLock()
+	generate := c.generateID
+	c.RUnlock()
+	if generate == nil {
+		generate = stringid.GenerateRandomID
+	}
+	for i := 0; i < maxIDAttempts; i++ {
+		id := generate()
 		if c.Container(id) == nil {
-			return id
+			return id, nil
 		}
+		log.Debugf("swarm ID %s is already in use, generating a new one", id)
 	}
+	return "", fmt.Errorf("unable to generate a unique swarm ID after %d attempts", maxIDAttempts)
 }
 
 // StartContainer starts a container.
@@ -143,7 +197,7 @@ func (c *Cluster) CreateContainer(config *cluster.ContainerConfig, name string,
 	// image platforms. before starting a container, fill in the constraint.
 	c.setOSTypeConstraint(config, authConfig)
 
-	container, err := c.createContainer(config, name, false, authConfig)
+	container, err := c.createContainer(config, name, false, nil, authConfig)
 
 	if err != nil {
 
@@ -151,7 +205,7 @@ func (c *Cluster) CreateContainer(config *cluster.ContainerConfig, name string,
 		osMismatch := api.MatchImageOSError(err.Error())
 		if osMismatch != "" {
 			config.AddConstraint("ostype==" + osMismatch)
-			container, err = c.createContainer(config, name, false, authConfig)
+			container, err = c.createContainer(config, name, false, nil, authConfig)
 			if err == nil {
 				return container, nil
 			}
@@ -169,14 +223,14 @@ func (c *Cluster) CreateContainer(config *cluster.ContainerConfig, name string,
 			// Check if the image exists in the cluster
 			// If exists, retry with an image affinity
 			if c.Image(config.Image) != nil {
-				container, err = c.createContainer(config, name, true, authConfig)
+				container, err = c.createContainer(config, name, true, nil, authConfig)
 				retries++
 			}
 		}
 
 		for ; retries < c.createRetry && err != nil; retries++ {
 			log.WithFields(log.Fields{"Name": "Swarm"}).Warnf("Failed to create container: %s, retrying", err)
-			container, err = c.createContainer(config, name, false, authConfig)
+			container, err = c.createContainer(config, name, false, nil, authConfig)
 		}
 	}
 	return container, err
@@ -250,34 +304,140 @@ func (c *Cluster) setOSTypeConstraint(config *cluster.ContainerConfig, authConfi
 	return nil
 }
 
-func (c *Cluster) createContainer(config *cluster.ContainerConfig, name string, withImageAffinity bool, authConfig *types.AuthConfig) (*cluster.Container, error) {
+// newPlacement records the constraints and affinities of config met by n, the
+// node chosen for the container, with the values of n they were matched
+// against.
+func newPlacement(config *cluster.ContainerConfig, n *node.Node) *cluster.Placement {
+	placement := &cluster.Placement{
+		Constraints: []string{},
+		Affinities:  []string{},
+		Labels:      make(map[string]string),
+	}
+	met := func(f filter.Filter, expr string) bool {
+		single := cluster.BuildContainerConfig(containertypes.Config{Env: []string{expr}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{})
+		nodes, err := f.Filter(single, []*node.Node{n}, true)
+		return err == nil && len(nodes) == 1
+	}
+
+	for _, constraint := range config.Constraints() {
+		if !met(&filter.ConstraintFilter{}, "constraint:"+constraint) {
+			continue
+		}
+		placement.Constraints = append(placement.Constraints, constraint)
+		keys, err := filter.ConstraintKeys(constraint)
+		if err != nil {
+			continue
+		}
+		for _, key := range keys {
+			if values := filter.ConstraintValues(key, n); len(values) > 0 {
+				placement.Labels[key] = strings.Join(values, ",")
+			}
+		}
+	}
+	for _, affinity := range config.Affinities() {
+		if met(&filter.AffinityFilter{}, "affinity:"+affinity) {
+			placement.Affinities = append(placement.Affinities, affinity)
+		}
+	}
+	return placement
+}
+
+func nameConflictError(name string) error {
+	return fmt.Errorf("Conflict: The name %s is already assigned. You have to delete (or rename) that container to be able to assign %s to a container again.", name, name)
+}
+
+// addLocalNetworkConstraint makes a container connected to a local network
+// prefer the engine of that network.
+func (c *Cluster) addLocalNetworkConstraint(config *cluster.ContainerConfig) {
+	if network := c.Networks().Get(string(config.HostConfig.NetworkMode)); network != nil && network.Scope == "local" {
+		if !config.HaveNodeConstraint() {
+			config.AddConstraint("node==~" + network.Engine.Name)
+		}
+		config.HostConfig.NetworkMode = containertypes.NetworkMode(network.Name)
+	}
+}
+
+// PlanDeployment returns the node CreateContainer would currently place the
+// container on, without creating it. config is left untouched. With the
+// random strategy, the planned node is only one of the possible choices.
+func (c *Cluster) PlanDeployment(config *cluster.ContainerConfig, name string) (*node.Node, error) {
+	// Placement adds expressions to the labels, work on a copy.
+	planned := *config.Copy()
+
+	// Prepare the config as CreateContainer does.
+	c.setOSTypeConstraint(&planned, nil)
+
+	c.scheduler.Lock()
+	defer c.scheduler.Unlock()
+
+	if !c.checkNameUniqueness(name) {
+		return nil, nameConflictError(name)
+	}
+
+	c.addLocalNetworkConstraint(&planned)
+
+	// An image which won't be pulled has to be on the node already, which
+	// is where CreateContainer ends up retrying with an image affinity.
+	if planned.PullPolicy() == cluster.PullNever {
+		planned.AddAffinity("image==" + planned.Image)
+	}
+
+	nodes, err := c.scheduler.SelectNodesForContainer(c.SchedulableNodes(), &planned)
+	if err != nil {
+		return nil, err
+	}
+	return nodes[0], nil
+}
+
+// createContainer schedules and creates a container. The image affinity, and
+// the node constraint when nodeID is not empty, only apply to the scheduling
+// and are not stored in the container config.
+func (c *Cluster) createContainer(config *cluster.ContainerConfig, name string, withImageAffinity bool, target *cluster.Engine, authConfig *types.AuthConfig) (*cluster.Container, error) {
 	c.scheduler.Lock()
 
 	// Ensure the name is available
 	if !c.checkNameUniqueness(name) {
 		c.scheduler.Unlock()
-		return nil, fmt.Errorf("Conflict: The name %s is already assigned. You have to delete (or rename) that container to be able to assign %s to a container again.", name, name)
+		return nil, nameConflictError(name)
 	}
 
 	swarmID := config.SwarmID()
 	if swarmID == "" {
 		// Associate a Swarm ID to the container we are creating.
-		swarmID = c.generateUniqueID()
+		var err error
+		if swarmID, err = c.generateUniqueID(); err != nil {
+			c.scheduler.Unlock()
+			return nil, err
+		}
 		config.SetSwarmID(swarmID)
 	}
 
-	if network := c.Networks().Get(string(config.HostConfig.NetworkMode)); network != nil && network.Scope == "local" {
-		if !config.HaveNodeConstraint() {
-			config.AddConstraint("node==~" + network.Engine.Name)
-		}
-		config.HostConfig.NetworkMode = containertypes.NetworkMode(network.Name)
-	}
+	c.addLocalNetworkConstraint(config)
 
 	if withImageAffinity {
 		config.AddAffinity("image==" + config.Image)
 	}
 
-	nodes, err := c.scheduler.SelectNodesForContainer(c.listNodes(), config)
+	// A target engine is the only candidate.
+	candidates := c.SchedulableNodes()
+	if target != nil {
+		candidates = nil
+		for _, n := range c.SchedulableNodes() {
+			if n.ID == target.ID {
+				candidates = append(candidates, n)
+			}
+		}
+		if len(candidates) == 0 {
+			c.scheduler.Unlock()
+			return nil, fmt.Errorf("%s is not available for scheduling", target.Name)
+		}
+	}
+
+	nodes, err := c.scheduler.SelectNodesForContainer(candidates, config)
+	var placement *cluster.Placement
+	if err == nil {
+		placement = newPlacement(config, nodes[0])
+	}
 
 	if withImageAffinity {
 		config.RemoveAffinity("image==" + config.Image)
@@ -302,7 +462,13 @@ func (c *Cluster) createContainer(config *cluster.ContainerConfig, name string,
 
 	c.scheduler.Unlock()
 
-	container, err := engine.CreateContainer(config, name, true, authConfig)
+	var container *cluster.Container
+	if config.PullPolicy() == cluster.PullAlways {
+		err = engine.Pull(config.Image, authConfig, nil)
+	}
+	if err == nil {
+		container, err = engine.CreateContainer(config, name, config.PullPolicy() != cluster.PullNever, authConfig)
+	}
 
 	if err != nil {
 		log.WithFields(log.Fields{"NodeName": n.Name, "NodeID": n.ID}).WithError(err).Error("Failed to create container")
@@ -312,6 +478,7 @@ func (c *Cluster) createContainer(config *cluster.ContainerConfig, name string,
 			containerFlag = stringid.TruncateID(container.ID)
 		}
 		log.WithFields(log.Fields{"NodeName": n.Name, "NodeID": n.ID}).Debugf("Scheduling container %s to ", containerFlag)
+		container.Placement = placement
 	}
 
 	c.scheduler.Lock()
@@ -326,6 +493,95 @@ func (c *Cluster) RemoveContainer(container *cluster.Container, force, volumes b
 	return container.Engine.RemoveContainer(container, force, volumes)
 }
 
+// PauseContainer pauses a container.
+func (c *Cluster) PauseContainer(container *cluster.Container) error {
+	return container.Engine.PauseContainer(container)
+}
+
+// UnpauseContainer unpauses a container.
+func (c *Cluster) UnpauseContainer(container *cluster.Container) error {
+	return container.Engine.UnpauseContainer(container)
+}
+
+// RemoveContainerGraceful stops a container, waiting up to stopTimeout for it
+// to exit, and then removes it. If the container could not be stopped the
+// removal falls back to force.
+func (c *Cluster) RemoveContainerGraceful(container *cluster.Container, stopTimeout time.Duration, volumes bool) error {
+	force := false
+	if err := container.Engine.StopContainer(container, &stopTimeout); err != nil {
+		log.WithFields(log.Fields{"name": container.Engine.Name, "id": container.ID}).Warnf("Unable to stop container, forcing removal: %v", err)
+		force = true
+	}
+	return container.Engine.RemoveContainer(container, force, volumes)
+}
+
+// MoveContainer recreates container on target with the same configuration,
+// swarm ID and mounts included, then removes the original and starts the new
+// container if the original was running. The new container is scheduled like
+// any other, with target as the only candidate. A node constraint of the
+// original is replaced by one pinning the new container to target. The
+// original is renamed out of the way meanwhile, and gets its name back if the
+// new container can't be created. The returned warnings list the mounts whose
+// data stays on the original engine.
+func (c *Cluster) MoveContainer(container *cluster.Container, target *cluster.Engine, authConfig *types.AuthConfig) (*cluster.Container, []string, error) {
+	if container.Engine.ID == target.ID {
+		return nil, nil, fmt.Errorf("container %s is already on %s", container.ID, target.Name)
+	}
+
+	warnings := []string{}
+	for _, m := range container.Info.Mounts {
+		if m.Type == "bind" {
+			warnings = append(warnings, fmt.Sprintf("bind mount %s:%s is local to %s, its data is not moved", m.Source, m.Destination, container.Engine.Name))
+		} else if m.Type == "volume" && (m.Driver == "" || m.Driver == "local") {
+			warnings = append(warnings, fmt.Sprintf("local volume %s on %s is local to %s, its data is not moved", m.Name, m.Destination, container.Engine.Name))
+		}
+	}
+
+	name := ""
+	if len(container.Names) > 0 {
+		name = strings.TrimPrefix(container.Names[0], "/")
+	}
+	running := container.Info.ContainerJSONBase != nil && container.Info.State != nil && container.Info.State.Running
+
+	if name != "" {
+		if err := c.RenameContainer(container, name+"-moving-"+stringid.TruncateID(container.ID)); err != nil {
+			return nil, warnings, err
+		}
+	}
+
+	// Scheduling adds constraints to the config, work on a copy.
+	config := container.Config.Copy()
+	pinned := config.HaveNodeConstraint()
+	for _, constraint := range config.Constraints() {
+		if strings.HasPrefix(constraint, "node==") || strings.HasPrefix(constraint, "node!=") {
+			config.RemoveConstraint(constraint)
+		}
+	}
+	if pinned {
+		config.AddConstraint("node==" + target.ID)
+	}
+
+	newContainer, err := c.createContainer(config, name, false, target, authConfig)
+	if err != nil {
+		if name != "" {
+			if err := c.RenameContainer(container, name); err != nil {
+				log.WithFields(log.Fields{"name": container.Engine.Name, "id": container.ID}).Errorf("Unable to restore the container name: %v", err)
+			}
+		}
+		return nil, warnings, err
+	}
+	if err := container.Engine.RemoveContainer(container, true, false); err != nil {
+		return newContainer, warnings, err
+	}
+	if running {
+		if err := target.StartContainer(newContainer); err != nil {
+			return newContainer, warnings, err
+		}
+	}
+	log.Infof("Moved container %s from %s to %s as %s", container.ID, container.Engine.Name, target.Name, newContainer.ID)
+	return newContainer, warnings, nil
+}
+
 // RemoveNetwork removes a network from the cluster.
 func (c *Cluster) RemoveNetwork(network *cluster.Network) error {
 	err := network.Engine.RemoveNetwork(network)
@@ -402,11 +658,47 @@ func (c *Cluster) addEngine(addr string) bool {
 	return true
 }
 
+// UpdateTLSConfig replaces the TLS configuration used to connect to engines,
+// for instance after a certificate rotation. It only applies to the engines
+// still pending validation and to the ones discovered later: validated
+// engines keep using the client they connected with, even when they become
+// unhealthy, until they leave discovery and are added back.
+func (c *Cluster) UpdateTLSConfig(config *tls.Config) {
+	c.Lock()
+	c.TLSConfig = config
+	c.Unlock()
+}
+
+// tlsConfig returns the TLS configuration used to connect to engines.
+func (c *Cluster) tlsConfig() *tls.Config {
+	c.RLock()
+	defer c.RUnlock()
+	return c.TLSConfig
+}
+
+// acquireConnectSlot blocks until an engine is allowed to connect, as set
+// by the swarm.maxconcurrentconnects option.
+func (c *Cluster) acquireConnectSlot() {
+	if c.connectSlots != nil {
+		c.connectSlots <- struct{}{}
+	}
+}
+
+// releaseConnectSlot lets another engine connect.
+func (c *Cluster) releaseConnectSlot() {
+	if c.connectSlots != nil {
+		<-c.connectSlots
+	}
+}
+
 // validatePendingEngine connects to the engine,
 func (c *Cluster) validatePendingEngine(engine *cluster.Engine) bool {
 	// Attempt a connection to the engine. Since this is slow, don't get a hold
 	// of the lock yet.
-	if err := engine.Connect(c.TLSConfig); err != nil {
+	c.acquireConnectSlot()
+	err := engine.Connect(c.tlsConfig())
+	c.releaseConnectSlot()
+	if err != nil {
 		log.WithFields(log.Fields{"Addr": engine.Addr}).Debugf("Failed to validate pending node: %s", err)
 		return false
 	}
@@ -898,7 +1190,8 @@ func (c *Cluster) Import(source string, ref string, tag string, imageReader io.R
 	wg.Wait()
 }
 
-// Containers returns all the containers in the cluster.
+// Containers returns all the containers in the cluster, ordered by creation
+// time and then by ID.
 func (c *Cluster) Containers() cluster.Containers {
 	c.RLock()
 	defer c.RUnlock()
@@ -907,10 +1200,53 @@ func (c *Cluster) Containers() cluster.Containers {
 	for _, e := range c.engines {
 		out = append(out, e.Containers()...)
 	}
+	out.SortBy(cluster.ByCreation)
 
 	return out
 }
 
+// ContainersByLabel returns all the containers in the cluster whose label key
+// is set to value, such as the members of a compose project.
+func (c *Cluster) ContainersByLabel(key, value string) cluster.Containers {
+	return c.Containers().FilterByLabel(key, value)
+}
+
+// GroupValues returns the distinct values of the label key across all the
+// containers in the cluster.
+func (c *Cluster) GroupValues(key string) []string {
+	return c.Containers().LabelValues(key)
+}
+
+// ContainersByPublishedPort returns all the containers in the cluster
+// publishing port on their node.
+func (c *Cluster) ContainersByPublishedPort(port int) cluster.Containers {
+	return c.Containers().FilterByPublishedPort(port)
+}
+
+// ForEachContainer applies action to all the containers in the cluster
+// matching selector, and returns the errors of the failed actions. The
+// engines of the matching containers are refreshed afterwards.
+func (c *Cluster) ForEachContainer(selector func(*cluster.Container) bool, action func(*cluster.Container) error) []error {
+	errs := []error{}
+	engines := make(map[string]*cluster.Engine)
+	for _, container := range c.Containers() {
+		if !selector(container) {
+			continue
+		}
+		if err := action(container); err != nil {
+			errs = append(errs, fmt.Errorf("container %s: %v", container.ID, err))
+		}
+		engines[container.Engine.ID] = container.Engine
+	}
+
+	for _, engine := range engines {
+		if err := engine.RefreshContainers(false); err != nil {
+			log.WithFields(log.Fields{"name": engine.Name, "id": engine.ID}).Errorf("Unable to refresh containers: %v", err)
+		}
+	}
+	return errs
+}
+
 func (c *Cluster) checkNameUniqueness(name string) bool {
 	// Abort immediately if the name is empty.
 	if len(name) == 0 {
@@ -993,6 +1329,23 @@ func (c *Cluster) listNodes() []*node.Node {
 	return out
 }
 
+// Nodes returns all the nodes in the cluster, cordoned ones included.
+func (c *Cluster) Nodes() []*node.Node {
+	return c.listNodes()
+}
+
+// SchedulableNodes returns the nodes in the cluster that can receive new
+// containers, leaving out the cordoned ones.
+func (c *Cluster) SchedulableNodes() []*node.Node {
+	out := []*node.Node{}
+	for _, n := range c.listNodes() {
+		if !n.Cordoned {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
 // listEngines returns all the engines in the cluster.
 // This is for reporting, not scheduling, hence pendingEngines are included.
 func (c *Cluster) listEngines() []*cluster.Engine {
@@ -1038,6 +1391,24 @@ func (c *Cluster) TotalCpus() int64 {
 	return totalCpus
 }
 
+// UsedMemory returns the memory reserved by containers in the cluster.
+func (c *Cluster) UsedMemory() int64 {
+	var usedMemory int64
+	for _, engine := range c.listActiveEngines() {
+		usedMemory += engine.UsedMemory()
+	}
+	return usedMemory
+}
+
+// UsedCpus returns the CPUs reserved by containers in the cluster.
+func (c *Cluster) UsedCpus() int64 {
+	var usedCpus int64
+	for _, engine := range c.listActiveEngines() {
+		usedCpus += engine.UsedCpus()
+	}
+	return usedCpus
+}
+
 // EngineNames returns the names of all the engines in the cluster.
 func (c *Cluster) EngineNames() []string {
 	ret := make([]string, len(c.engines))
@@ -1182,7 +1553,7 @@ func (c *Cluster) BuildImage(buildContext io.Reader, buildImage *types.ImageBuil
 
 		buildImage.BuildArgs = convertKVStringsToMap(config.Env)
 		c.scheduler.Lock()
-		nodes, err := c.scheduler.SelectNodesForContainer(c.listNodes(), config)
+		nodes, err := c.scheduler.SelectNodesForContainer(c.SchedulableNodes(), config)
 		c.scheduler.Unlock()
 		if err != nil {
 			return err
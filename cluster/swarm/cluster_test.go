@@ -2,9 +2,18 @@ package swarm
 
 import (
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -14,10 +23,13 @@ import (
 	networktypes "github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/api/types/registry"
 	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/pkg/discovery"
+	"github.com/docker/docker/pkg/discovery/nodes"
 	engineapimock "github.com/docker/swarm/api/mockclient"
 	"github.com/docker/swarm/cluster"
 	"github.com/docker/swarm/scheduler"
 	"github.com/docker/swarm/scheduler/filter"
+	"github.com/docker/swarm/scheduler/node"
 	"github.com/docker/swarm/scheduler/strategy"
 	"github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/stretchr/testify/assert"
@@ -433,3 +445,824 @@ func mockClientWithInit() *engineapimock.MockClient {
 
 	return apiClient
 }
+
+func TestMonitorDiscoveryAddRemove(t *testing.T) {
+	c := &Cluster{
+		ClusterEventHandlers: cluster.NewClusterEventHandlers(),
+		engines:              make(map[string]*cluster.Engine),
+		pendingEngines:       make(map[string]*cluster.Engine),
+		engineOpts:           engOpts,
+		connectSlots:         make(chan struct{}, 1),
+	}
+	// Hold the only connect slot so the engine stays pending without
+	// validation dialing it in the background.
+	c.acquireConnectSlot()
+
+	ch := make(chan discovery.Entries)
+	errCh := make(chan error)
+	go c.monitorDiscovery(ch, errCh)
+
+	entries, err := discovery.CreateEntries([]string{"127.0.0.1:1"})
+	assert.NoError(t, err)
+	ch <- entries
+	assert.True(t, waitFor(func() bool { return c.hasEngineByAddr("127.0.0.1:1") }))
+	engine := c.getEngineByAddr("127.0.0.1:1")
+
+	// The engine vanishes from discovery and must be removed.
+	ch <- discovery.Entries{}
+	assert.True(t, waitFor(func() bool { return !c.hasEngineByAddr("127.0.0.1:1") }))
+
+	// Once removed, a late validation must not bring the engine back.
+	c.releaseConnectSlot()
+	assert.False(t, c.validatePendingEngine(engine))
+	assert.False(t, c.hasEngineByAddr("127.0.0.1:1"))
+}
+
+// waitFor polls cond until it returns true or a timeout expires.
+func waitFor(cond func() bool) bool {
+	for i := 0; i < 100; i++ {
+		if cond() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestRemoveEngine(t *testing.T) {
+	c := &Cluster{
+		engines:        make(map[string]*cluster.Engine),
+		pendingEngines: make(map[string]*cluster.Engine),
+	}
+
+	e1 := createEngine(t, "engine-1", &cluster.Container{
+		Container: types.Container{ID: "container1-id"},
+		Config:    cluster.BuildContainerConfig(containertypes.Config{}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}),
+	})
+	e2 := createEngine(t, "engine-2", &cluster.Container{
+		Container: types.Container{ID: "container2-id"},
+		Config:    cluster.BuildContainerConfig(containertypes.Config{}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}),
+	})
+	c.engines[e1.ID] = e1
+	c.engines[e2.ID] = e2
+	assert.Len(t, c.Containers(), 2)
+
+	// Unknown engines can't be removed.
+	assert.False(t, c.removeEngine("unknown"))
+
+	assert.True(t, c.removeEngine(e1.Addr))
+	assert.Len(t, c.Containers(), 1)
+	assert.Nil(t, c.Container("container1-id"))
+	assert.NotNil(t, c.Container("container2-id"))
+	assert.Len(t, c.listActiveEngines(), 1)
+}
+
+func TestContainersOrdering(t *testing.T) {
+	c := &Cluster{
+		engines: make(map[string]*cluster.Engine),
+	}
+
+	for i := 0; i < 4; i++ {
+		e := createEngine(t, fmt.Sprintf("engine-%d", i))
+		for j := 0; j < 4; j++ {
+			e.AddContainer(&cluster.Container{
+				Container: types.Container{
+					ID:      fmt.Sprintf("container-%d-%d", i, j),
+					Created: int64(j),
+				},
+				Config: cluster.BuildContainerConfig(containertypes.Config{}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}),
+				Engine: e,
+			})
+		}
+		c.engines[e.ID] = e
+	}
+
+	first := c.Containers()
+	assert.Len(t, first, 16)
+	assert.Equal(t, first[0].ID, "container-0-0")
+	assert.Equal(t, first[15].ID, "container-3-3")
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, c.Containers(), first)
+	}
+}
+
+func TestClusterCapacity(t *testing.T) {
+	c := &Cluster{
+		engines: make(map[string]*cluster.Engine),
+	}
+
+	container := func(ID string, memory, cpus int64) *cluster.Container {
+		return &cluster.Container{
+			Container: types.Container{ID: ID},
+			Config: cluster.BuildContainerConfig(containertypes.Config{}, containertypes.HostConfig{
+				Resources: containertypes.Resources{
+					Memory:    memory,
+					CPUShares: cpus,
+				},
+			}, networktypes.NetworkingConfig{}),
+		}
+	}
+
+	e1 := createEngine(t, "engine-1", container("c1", 100, 1), container("c2", 200, 2))
+	e1.Memory, e1.Cpus = 1000, 4
+	e2 := createEngine(t, "engine-2", container("c3", 300, 1))
+	e2.Memory, e2.Cpus = 2000, 8
+	c.engines[e1.ID] = e1
+	c.engines[e2.ID] = e2
+
+	assert.Equal(t, c.TotalMemory(), int64(3000))
+	assert.Equal(t, c.TotalCpus(), int64(12))
+	assert.Equal(t, c.UsedMemory(), int64(600))
+	assert.Equal(t, c.UsedCpus(), int64(4))
+}
+
+func TestSchedulableNodes(t *testing.T) {
+	c := &Cluster{
+		engines: make(map[string]*cluster.Engine),
+	}
+	e1 := createEngine(t, "engine-1")
+	e2 := createEngine(t, "engine-2")
+	c.engines[e1.ID] = e1
+	c.engines[e2.ID] = e2
+
+	assert.Len(t, c.Nodes(), 2)
+	assert.Len(t, c.SchedulableNodes(), 2)
+
+	e1.Cordon()
+	assert.True(t, e1.IsCordoned())
+	assert.Len(t, c.Nodes(), 2)
+	schedulable := c.SchedulableNodes()
+	assert.Len(t, schedulable, 1)
+	assert.Equal(t, e2.ID, schedulable[0].ID)
+
+	e1.Uncordon()
+	assert.False(t, e1.IsCordoned())
+	assert.Len(t, c.SchedulableNodes(), 2)
+}
+
+func TestUpdateTLSConfig(t *testing.T) {
+	oldConfig := &tls.Config{ServerName: "old"}
+	newConfig := &tls.Config{ServerName: "new"}
+	c := &Cluster{
+		engines:   make(map[string]*cluster.Engine),
+		TLSConfig: oldConfig,
+	}
+	engine := createEngine(t, "engine-1")
+	c.engines[engine.ID] = engine
+
+	assert.Equal(t, c.tlsConfig(), oldConfig)
+	c.UpdateTLSConfig(newConfig)
+	assert.Equal(t, c.tlsConfig(), newConfig)
+
+	// Engines already registered are left alone.
+	assert.Len(t, c.engines, 1)
+	assert.Equal(t, c.engines[engine.ID], engine)
+}
+
+func TestUpdateTLSConfigPendingEngine(t *testing.T) {
+	var (
+		lock     sync.Mutex
+		requests int
+	)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests++
+		lock.Unlock()
+		http.Error(w, "not an engine", http.StatusInternalServerError)
+	}))
+	// the rejected handshake is expected
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+	received := func() int {
+		lock.Lock()
+		defer lock.Unlock()
+		return requests
+	}
+
+	// Only the updated configuration trusts the server certificate.
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	c := &Cluster{
+		ClusterEventHandlers: cluster.NewClusterEventHandlers(),
+		engines:              make(map[string]*cluster.Engine),
+		pendingEngines:       make(map[string]*cluster.Engine),
+		engineOpts:           engOpts,
+		TLSConfig:            &tls.Config{RootCAs: x509.NewCertPool()},
+	}
+	addr := server.Listener.Addr().String()
+	engine := cluster.NewEngine(addr, 0, engOpts)
+	c.pendingEngines[addr] = engine
+
+	assert.False(t, c.validatePendingEngine(engine))
+	assert.Equal(t, 0, received())
+
+	c.UpdateTLSConfig(&tls.Config{RootCAs: roots})
+	c.validatePendingEngine(engine)
+	assert.NotEqual(t, 0, received())
+}
+
+func TestNewClusterOptions(t *testing.T) {
+	invalid := []cluster.DriverOpts{
+		{"swarm.overcommit=-1"},
+		{"swarm.overcommit=-2.5"},
+		{"swarm.overcommit=lots"},
+		{"swarm.createretry=-1"},
+		{"swarm.createretry=1.5"},
+		{"swarm.createretry=many"},
+		{"swarm.maxconcurrentconnects=-1"},
+		{"swarm.maxconcurrentconnects=few"},
+		{"swarm.eventbuffersize=-1"},
+		{"swarm.eventbuffersize=lots"},
+	}
+	for _, opts := range invalid {
+		_, err := NewCluster(nil, nil, nil, opts, engOpts)
+		assert.Error(t, err, "%v should be rejected", opts)
+	}
+}
+
+func TestConnectSlots(t *testing.T) {
+	// Unbounded by default.
+	c := &Cluster{}
+	for i := 0; i < 10; i++ {
+		c.acquireConnectSlot()
+	}
+
+	c = &Cluster{connectSlots: make(chan struct{}, 2)}
+	c.acquireConnectSlot()
+	c.acquireConnectSlot()
+
+	acquired := make(chan struct{})
+	go func() {
+		c.acquireConnectSlot()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("a third engine connected while two were connecting")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	c.releaseConnectSlot()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("an engine couldn't connect after a slot was released")
+	}
+}
+
+func TestGenerateUniqueID(t *testing.T) {
+	cl, err := NewCluster(nil, nil, &nodes.Discovery{}, nil, engOpts)
+	assert.NoError(t, err)
+	c := cl.(*Cluster)
+
+	// Random IDs by default.
+	id1, err := c.generateUniqueID()
+	assert.NoError(t, err)
+	assert.Len(t, id1, 64)
+	id2, err := c.generateUniqueID()
+	assert.NoError(t, err)
+	assert.NotEqual(t, id1, id2)
+
+	// Injected generator.
+	count := 0
+	c.SetIDGenerator(func() string {
+		count++
+		return fmt.Sprintf("swarm-id-%d", count)
+	})
+	id, err := c.generateUniqueID()
+	assert.NoError(t, err)
+	assert.Equal(t, id, "swarm-id-1")
+	id, err = c.generateUniqueID()
+	assert.NoError(t, err)
+	assert.Equal(t, id, "swarm-id-2")
+
+	// Back to random IDs.
+	c.SetIDGenerator(nil)
+	id, err = c.generateUniqueID()
+	assert.NoError(t, err)
+	assert.Len(t, id, 64)
+}
+
+func TestGenerateUniqueIDCollision(t *testing.T) {
+	container := &cluster.Container{
+		Container: types.Container{ID: "container-id"},
+		Config: cluster.BuildContainerConfig(containertypes.Config{
+			Labels: map[string]string{
+				"com.docker.swarm.id": "swarm-id-taken",
+			},
+		}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}),
+	}
+	engine := createEngine(t, "engine-1", container)
+	c := &Cluster{
+		engines: map[string]*cluster.Engine{engine.ID: engine},
+	}
+
+	// The first candidate is taken, the second one is used.
+	ids := []string{"swarm-id-taken", "swarm-id-free"}
+	c.SetIDGenerator(func() string {
+		id := ids[0]
+		ids = ids[1:]
+		return id
+	})
+	id, err := c.generateUniqueID()
+	assert.NoError(t, err)
+	assert.Equal(t, id, "swarm-id-free")
+
+	// Give up when every candidate is taken.
+	attempts := 0
+	c.SetIDGenerator(func() string {
+		attempts++
+		return "swarm-id-taken"
+	})
+	_, err = c.generateUniqueID()
+	assert.Error(t, err)
+	assert.Equal(t, attempts, maxIDAttempts)
+}
+
+// newMockEngine returns an engine connected to a mock client.
+func newMockEngine(id string) (*cluster.Engine, *engineapimock.MockClient) {
+	engine := cluster.NewEngine(id, 0, engOpts)
+	engine.Name = id
+	engine.ID = id
+
+	apiClient := engineapimock.NewMockClient()
+	apiClient.On("Info", mock.Anything).Return(mockInfo, nil)
+	apiClient.On("ServerVersion", mock.Anything).Return(mockVersion, nil)
+	apiClient.On("NetworkList", mock.Anything,
+		mock.AnythingOfType("NetworkListOptions"),
+	).Return([]types.NetworkResource{}, nil)
+	apiClient.On("VolumeList", mock.Anything, mock.Anything).Return(volume.VolumeListOKBody{}, nil)
+	apiClient.On("Events", mock.Anything, mock.AnythingOfType("EventsOptions")).Return(make(chan events.Message), make(chan error))
+	apiClient.On("ImageList", mock.Anything, mock.AnythingOfType("ImageListOptions")).Return([]types.ImageSummary{}, nil)
+	apiClient.On("ContainerList", mock.Anything, types.ContainerListOptions{All: true, Size: false}).Return([]types.Container{}, nil).Once()
+	apiClient.On("NegotiateAPIVersion", mock.Anything).Return()
+	engine.ConnectWithClient(apiClient)
+
+	return engine, apiClient
+}
+
+func TestRemoveContainerGraceful(t *testing.T) {
+	for _, stopErr := range []error{nil, fmt.Errorf("stop timed out")} {
+		engine, apiClient := newMockEngine("test-engine")
+		c := &Cluster{engines: map[string]*cluster.Engine{engine.ID: engine}}
+		container := &cluster.Container{Container: types.Container{ID: "container-id"}, Engine: engine}
+
+		var calls []string
+		timeout := 5 * time.Second
+		apiClient.On("ContainerStop", mock.Anything, "container-id", &timeout).Return(stopErr).Run(func(mock.Arguments) {
+			calls = append(calls, "stop")
+		}).Once()
+		apiClient.On("ContainerList", mock.Anything, mock.AnythingOfType("ContainerListOptions")).Return([]types.Container{}, nil)
+		apiClient.On("ContainerRemove", mock.Anything, "container-id", types.ContainerRemoveOptions{Force: stopErr != nil}).Return(nil).Run(func(mock.Arguments) {
+			calls = append(calls, "remove")
+		}).Once()
+
+		assert.NoError(t, c.RemoveContainerGraceful(container, timeout, false))
+		assert.Equal(t, []string{"stop", "remove"}, calls)
+	}
+}
+
+func TestPauseUnpauseContainer(t *testing.T) {
+	engine, apiClient := newMockEngine("test-engine")
+	c := &Cluster{engines: map[string]*cluster.Engine{engine.ID: engine}}
+	container := &cluster.Container{Container: types.Container{ID: "container-id"}, Engine: engine}
+
+	inspect := func(paused bool) types.ContainerJSON {
+		return types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{
+				HostConfig: &containertypes.HostConfig{},
+				State:      &types.ContainerState{Running: true, Paused: paused, StartedAt: "2016-06-06T01:41:38.090313266Z"},
+			},
+			Config:          &containertypes.Config{},
+			NetworkSettings: &types.NetworkSettings{},
+		}
+	}
+	apiClient.On("ContainerList", mock.Anything, mock.AnythingOfType("ContainerListOptions")).Return([]types.Container{{ID: "container-id"}}, nil)
+
+	apiClient.On("ContainerPause", mock.Anything, "container-id").Return(nil).Once()
+	apiClient.On("ContainerInspect", mock.Anything, "container-id").Return(inspect(true), nil).Once()
+	assert.NoError(t, c.PauseContainer(container))
+	assert.Equal(t, "paused", cluster.StateString(c.Container("container-id").Info.State))
+
+	apiClient.On("ContainerUnpause", mock.Anything, "container-id").Return(nil).Once()
+	apiClient.On("ContainerInspect", mock.Anything, "container-id").Return(inspect(false), nil).Once()
+	assert.NoError(t, c.UnpauseContainer(container))
+	assert.Equal(t, "running", cluster.StateString(c.Container("container-id").Info.State))
+
+	apiClient.On("ContainerPause", mock.Anything, "container-id").Return(fmt.Errorf("pause failed")).Once()
+	assert.Error(t, c.PauseContainer(container))
+	apiClient.AssertNumberOfCalls(t, "ContainerInspect", 2)
+}
+
+func TestForEachContainer(t *testing.T) {
+	engine, apiClient := newMockEngine("test-engine")
+	c := &Cluster{engines: map[string]*cluster.Engine{engine.ID: engine}}
+
+	group := map[string]string{"com.docker.compose.project": "web"}
+	web1 := types.Container{ID: "web1", Labels: group}
+	web2 := types.Container{ID: "web2", Labels: group}
+	db := types.Container{ID: "db"}
+	for _, container := range []types.Container{web1, web2, db} {
+		engine.AddContainer(&cluster.Container{Container: container, Engine: engine})
+	}
+	apiClient.On("ContainerList", mock.Anything, types.ContainerListOptions{All: true, Size: false}).Return([]types.Container{web1, web2, db}, nil)
+
+	stopped := []string{}
+	stop := func(container *cluster.Container) error {
+		stopped = append(stopped, container.ID)
+		if container.ID == "web2" {
+			return fmt.Errorf("stop failed")
+		}
+		return nil
+	}
+	inGroup := func(container *cluster.Container) bool {
+		return container.Labels["com.docker.compose.project"] == "web"
+	}
+
+	refreshes := func() int {
+		n := 0
+		for _, call := range apiClient.Calls {
+			if call.Method == "ContainerList" {
+				n++
+			}
+		}
+		return n
+	}
+	before := refreshes()
+
+	errs := c.ForEachContainer(inGroup, stop)
+	assert.Len(t, stopped, 2)
+	assert.Contains(t, stopped, "web1")
+	assert.Contains(t, stopped, "web2")
+	assert.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "web2")
+	assert.Contains(t, errs[0].Error(), "stop failed")
+
+	// the engine was refreshed after the actions
+	assert.Equal(t, before+1, refreshes())
+
+	// nothing matches, nothing is refreshed
+	assert.Empty(t, c.ForEachContainer(func(*cluster.Container) bool { return false }, stop))
+	assert.Equal(t, before+1, refreshes())
+}
+
+func TestPlanDeployment(t *testing.T) {
+	strat, err := strategy.New("spread")
+	assert.NoError(t, err)
+	filters, err := filter.New([]string{"constraint"})
+	assert.NoError(t, err)
+	c := &Cluster{
+		engines:   make(map[string]*cluster.Engine),
+		scheduler: scheduler.New(strat, filters),
+	}
+
+	e1 := createEngine(t, "engine-1", &cluster.Container{
+		Container: types.Container{ID: "web-id", Names: []string{"/web"}},
+		Config:    cluster.BuildContainerConfig(containertypes.Config{}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}),
+	})
+	e1.Memory, e1.Cpus = 1024, 2
+	e2 := createEngine(t, "engine-2")
+	e2.Memory, e2.Cpus = 1024, 2
+	c.engines[e1.ID] = e1
+	c.engines[e2.ID] = e2
+
+	// spread prefers the engine running fewer containers
+	config := cluster.BuildContainerConfig(containertypes.Config{Image: "redis"}, containertypes.HostConfig{}, networktypes.NetworkingConfig{})
+	planned, err := c.PlanDeployment(config, "redis")
+	assert.NoError(t, err)
+	assert.Equal(t, e2.ID, planned.ID)
+
+	// constraints are honored and config is left untouched
+	config = cluster.BuildContainerConfig(containertypes.Config{Image: "redis", Env: []string{"constraint:node==engine-1"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{})
+	labels := len(config.Labels)
+	planned, err = c.PlanDeployment(config, "redis")
+	assert.NoError(t, err)
+	assert.Equal(t, e1.ID, planned.ID)
+	assert.Len(t, config.Labels, labels)
+	assert.Empty(t, config.SwarmID())
+
+	// cordoned engines are not planned
+	e1.Cordon()
+	_, err = c.PlanDeployment(config, "redis")
+	assert.Error(t, err)
+	e1.Uncordon()
+
+	// the name must be available
+	_, err = c.PlanDeployment(config, "web")
+	assert.Error(t, err)
+}
+
+// newConnectedMockEngine returns an engine fully connected to a mock client
+// reporting info and images.
+func newConnectedMockEngine(t *testing.T, addr string, info types.Info, images []types.ImageSummary) (*cluster.Engine, *engineapimock.MockClient) {
+	engine := cluster.NewEngine(addr, 0, engOpts)
+
+	apiClient := engineapimock.NewMockClient()
+	apiClient.On("Info", mock.Anything).Return(info, nil)
+	apiClient.On("ServerVersion", mock.Anything).Return(mockVersion, nil)
+	apiClient.On("NetworkList", mock.Anything,
+		mock.AnythingOfType("NetworkListOptions"),
+	).Return([]types.NetworkResource{}, nil)
+	apiClient.On("VolumeList", mock.Anything, mock.Anything).Return(volume.VolumeListOKBody{}, nil)
+	apiClient.On("Events", mock.Anything, mock.AnythingOfType("EventsOptions")).Return(make(chan events.Message), make(chan error))
+	apiClient.On("ImageList", mock.Anything, mock.AnythingOfType("ImageListOptions")).Return(images, nil)
+	apiClient.On("ContainerList", mock.Anything, types.ContainerListOptions{All: true, Size: false}).Return([]types.Container{}, nil).Once()
+	apiClient.On("NegotiateAPIVersion", mock.Anything).Return()
+	assert.NoError(t, engine.ConnectWithClient(apiClient))
+
+	return engine, apiClient
+}
+
+func TestPlanDeploymentPreparation(t *testing.T) {
+	strat, err := strategy.New("spread")
+	assert.NoError(t, err)
+	filters, err := filter.New([]string{"constraint", "affinity"})
+	assert.NoError(t, err)
+	c := &Cluster{
+		engines:   make(map[string]*cluster.Engine),
+		scheduler: scheduler.New(strat, filters),
+	}
+
+	windowsInfo, linuxInfo := mockInfo, mockInfo
+	windowsInfo.OSType, linuxInfo.OSType = "windows", "linux"
+	redis := []types.ImageSummary{{ID: "redis-id", RepoTags: []string{"redis:latest"}}}
+	engines := []struct {
+		addr       string
+		info       types.Info
+		images     []types.ImageSummary
+		containers int
+	}{
+		// spread prefers windows, then linux-2, then linux-1
+		{"windows:2375", windowsInfo, nil, 0},
+		{"linux-1:2375", linuxInfo, redis, 2},
+		{"linux-2:2375", linuxInfo, nil, 1},
+	}
+	for _, e := range engines {
+		engine, apiClient := newConnectedMockEngine(t, e.addr, e.info, e.images)
+		// the images only run on linux
+		apiClient.On("DistributionInspect", mock.Anything, mock.Anything, mock.Anything).Return(registry.DistributionInspect{
+			Platforms: []v1.Platform{{OS: "linux", Architecture: "amd64"}},
+		}, nil)
+		for i := 0; i < e.containers; i++ {
+			engine.AddContainer(&cluster.Container{
+				Container: types.Container{ID: fmt.Sprintf("%s-%d", e.addr, i)},
+				Config:    cluster.BuildContainerConfig(containertypes.Config{}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}),
+				Engine:    engine,
+			})
+		}
+		c.engines[engine.ID] = engine
+	}
+
+	// the OS type of the image is honored
+	config := cluster.BuildContainerConfig(containertypes.Config{Image: "busybox"}, containertypes.HostConfig{}, networktypes.NetworkingConfig{})
+	planned, err := c.PlanDeployment(config, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "linux-2:2375", planned.Addr)
+	assert.Empty(t, config.Constraints())
+
+	// an image which won't be pulled has to be on the node
+	config = cluster.BuildContainerConfig(containertypes.Config{
+		Image:  "redis",
+		Labels: map[string]string{"com.docker.swarm.pull-policy": cluster.PullNever},
+	}, containertypes.HostConfig{}, networktypes.NetworkingConfig{})
+	planned, err = c.PlanDeployment(config, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "linux-1:2375", planned.Addr)
+	assert.Empty(t, config.Affinities())
+}
+
+// newMoveCluster returns a cluster with a source and a target engine, the
+// source running a container named db.
+func newMoveCluster(t *testing.T) (*Cluster, *cluster.Container, *engineapimock.MockClient, *engineapimock.MockClient) {
+	strat, err := strategy.New("spread")
+	assert.NoError(t, err)
+	filters, err := filter.New([]string{"constraint"})
+	assert.NoError(t, err)
+	source, sourceClient := newMockEngine("source")
+	target, targetClient := newMockEngine("target")
+	for _, e := range []*cluster.Engine{source, target} {
+		e.Memory, e.Cpus = 1024, 2
+	}
+	c := &Cluster{
+		engines:           map[string]*cluster.Engine{source.ID: source, target.ID: target},
+		pendingContainers: make(map[string]*pendingContainer),
+		scheduler:         scheduler.New(strat, filters),
+	}
+
+	config := cluster.BuildContainerConfig(containertypes.Config{
+		Image:  "postgres",
+		Labels: map[string]string{"com.docker.swarm.id": "swarm-id"},
+	}, containertypes.HostConfig{
+		Binds: []string{"/srv/pg:/var/lib/postgresql/data", "shared:/backup", "cache:/cache"},
+	}, networktypes.NetworkingConfig{})
+	container := &cluster.Container{
+		Container: types.Container{ID: "old-id", Names: []string{"/db"}},
+		Config:    config,
+		Engine:    source,
+		Info: types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{
+				Name:  "/db",
+				State: &types.ContainerState{},
+			},
+			Mounts: []types.MountPoint{
+				{Type: "bind", Source: "/srv/pg", Destination: "/var/lib/postgresql/data"},
+				{Type: "volume", Name: "shared", Destination: "/backup", Driver: "nfs"},
+				{Type: "volume", Name: "cache", Destination: "/cache", Driver: "local"},
+			},
+		},
+	}
+	assert.NoError(t, source.AddContainer(container))
+
+	// the original is renamed out of the way while moving
+	inspect := func(name string) types.ContainerJSON {
+		return types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{
+				Name:       name,
+				HostConfig: &config.HostConfig,
+				State:      &types.ContainerState{},
+			},
+			Config:          &config.Config,
+			NetworkSettings: &types.NetworkSettings{},
+		}
+	}
+	sourceClient.On("ContainerRename", mock.Anything, "old-id", "db-moving-old-id").Return(nil).Once()
+	sourceClient.On("ContainerList", mock.Anything, mock.AnythingOfType("ContainerListOptions")).Return([]types.Container{{ID: "old-id", Names: []string{"/db-moving-old-id"}}}, nil).Once()
+	sourceClient.On("ContainerInspect", mock.Anything, "old-id").Return(inspect("/db-moving-old-id"), nil).Once()
+
+	return c, container, sourceClient, targetClient
+}
+
+func TestMoveContainer(t *testing.T) {
+	c, container, sourceClient, targetClient := newMoveCluster(t)
+	source, target := container.Engine, c.engines["target"]
+	binds := container.Config.HostConfig.Binds
+
+	targetClient.On("ContainerCreate", mock.Anything, mock.Anything, mock.Anything, mock.Anything, "db").Return(containertypes.ContainerCreateCreatedBody{ID: "new-id"}, nil).Run(func(args mock.Arguments) {
+		// the mounts follow the container, the node constraint doesn't
+		assert.Equal(t, binds, args.Get(2).(*containertypes.HostConfig).Binds)
+		config := cluster.BuildContainerConfig(*args.Get(1).(*containertypes.Config), containertypes.HostConfig{}, networktypes.NetworkingConfig{})
+		assert.Equal(t, "swarm-id", config.SwarmID())
+		assert.Empty(t, config.Constraints())
+	}).Once()
+	targetClient.On("ContainerList", mock.Anything, mock.AnythingOfType("ContainerListOptions")).Return([]types.Container{{ID: "new-id", Names: []string{"/db"}}}, nil)
+	targetClient.On("ContainerInspect", mock.Anything, "new-id").Return(types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			HostConfig: &container.Config.HostConfig,
+			State:      &types.ContainerState{},
+		},
+		Config:          &container.Config.Config,
+		NetworkSettings: &types.NetworkSettings{},
+	}, nil)
+	sourceClient.On("ContainerRemove", mock.Anything, "old-id", types.ContainerRemoveOptions{Force: true}).Return(nil).Once()
+
+	labels := copyLabels(container.Config.Labels)
+	moved, warnings, err := c.MoveContainer(container, target, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "new-id", moved.ID)
+	assert.Equal(t, target, moved.Engine)
+	assert.Equal(t, "swarm-id", moved.Config.SwarmID())
+	assert.Equal(t, moved, c.Container("swarm-id"))
+	assert.Nil(t, source.Containers().Get("old-id"))
+	assert.Len(t, warnings, 2)
+	assert.Contains(t, warnings[0], "/srv/pg")
+	assert.Contains(t, warnings[1], "cache")
+	sourceClient.AssertCalled(t, "ContainerRemove", mock.Anything, "old-id", types.ContainerRemoveOptions{Force: true})
+	// scheduling left the config of the original alone
+	assert.Equal(t, labels, container.Config.Labels)
+
+	// moving to the same engine is refused
+	_, _, err = c.MoveContainer(moved, target, nil)
+	assert.Error(t, err)
+}
+
+func TestMoveContainerNameConflict(t *testing.T) {
+	c, container, sourceClient, targetClient := newMoveCluster(t)
+	source, target := container.Engine, c.engines["target"]
+
+	// another container is being created with the name, once it's free
+	c.pendingContainers["other-swarm-id"] = &pendingContainer{
+		Name:   "db",
+		Config: cluster.BuildContainerConfig(containertypes.Config{}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}),
+		Engine: target,
+	}
+	_, _, err := c.MoveContainer(container, target, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Conflict")
+	targetClient.AssertNotCalled(t, "ContainerCreate", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	sourceClient.AssertNotCalled(t, "ContainerRemove", mock.Anything, mock.Anything, mock.Anything)
+
+	// the original is left in place, under the temporary name since the
+	// other container took its name
+	old := source.Containers().Get("old-id")
+	if assert.NotNil(t, old) {
+		assert.Equal(t, "/db-moving-old-id", old.Info.Name)
+	}
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	copied := make(map[string]string, len(labels))
+	for k, v := range labels {
+		copied[k] = v
+	}
+	return copied
+}
+
+func TestMoveContainerPinned(t *testing.T) {
+	c, container, sourceClient, targetClient := newMoveCluster(t)
+	target := c.engines["target"]
+	container.Config.AddConstraint("node==source")
+	container.Config.AddConstraint("region==eu")
+	target.Labels["region"] = "eu"
+	labels := copyLabels(container.Config.Labels)
+
+	targetClient.On("ContainerCreate", mock.Anything, mock.Anything, mock.Anything, mock.Anything, "db").Return(containertypes.ContainerCreateCreatedBody{ID: "new-id"}, nil).Run(func(args mock.Arguments) {
+		// the pin follows the container, the other constraints are kept
+		config := cluster.BuildContainerConfig(*args.Get(1).(*containertypes.Config), containertypes.HostConfig{}, networktypes.NetworkingConfig{})
+		assert.Equal(t, []string{"region==eu", "node==target"}, config.Constraints())
+	}).Once()
+	targetClient.On("ContainerList", mock.Anything, mock.AnythingOfType("ContainerListOptions")).Return([]types.Container{{ID: "new-id", Names: []string{"/db"}}}, nil)
+	targetClient.On("ContainerInspect", mock.Anything, "new-id").Return(types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			HostConfig: &containertypes.HostConfig{},
+			State:      &types.ContainerState{},
+		},
+		Config:          &containertypes.Config{},
+		NetworkSettings: &types.NetworkSettings{},
+	}, nil)
+	sourceClient.On("ContainerRemove", mock.Anything, "old-id", types.ContainerRemoveOptions{Force: true}).Return(nil).Once()
+
+	moved, _, err := c.MoveContainer(container, target, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, target, moved.Engine)
+	assert.Equal(t, labels, container.Config.Labels)
+}
+
+// imageNotFoundError is returned by the engine when an image is missing.
+type imageNotFoundError struct{}
+
+func (imageNotFoundError) Error() string  { return "No such image: private/db" }
+func (imageNotFoundError) NotFound() bool { return true }
+
+func TestMoveContainerPullsWithAuth(t *testing.T) {
+	c, container, sourceClient, targetClient := newMoveCluster(t)
+	target := c.engines["target"]
+	auth := &types.AuthConfig{Username: "user", Password: "secret"}
+	buf, err := json.Marshal(auth)
+	assert.NoError(t, err)
+	encodedAuth := base64.URLEncoding.EncodeToString(buf)
+
+	// the target doesn't have the image, it's pulled with the credentials
+	targetClient.On("ContainerCreate", mock.Anything, mock.Anything, mock.Anything, mock.Anything, "db").Return(containertypes.ContainerCreateCreatedBody{}, imageNotFoundError{}).Once()
+	targetClient.On("ImagePull", mock.Anything, "postgres", types.ImagePullOptions{RegistryAuth: encodedAuth}).Return(ioutil.NopCloser(bytes.NewBufferString("")), nil).Once()
+	targetClient.On("ContainerCreate", mock.Anything, mock.Anything, mock.Anything, mock.Anything, "db").Return(containertypes.ContainerCreateCreatedBody{ID: "new-id"}, nil).Once()
+	targetClient.On("ContainerList", mock.Anything, mock.AnythingOfType("ContainerListOptions")).Return([]types.Container{{ID: "new-id", Names: []string{"/db"}}}, nil)
+	targetClient.On("ContainerInspect", mock.Anything, "new-id").Return(types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			HostConfig: &containertypes.HostConfig{},
+			State:      &types.ContainerState{},
+		},
+		Config:          &containertypes.Config{},
+		NetworkSettings: &types.NetworkSettings{},
+	}, nil)
+	targetClient.On("ImageList", mock.Anything, mock.AnythingOfType("ImageListOptions")).Return([]types.ImageSummary{}, nil)
+	sourceClient.On("ContainerRemove", mock.Anything, "old-id", types.ContainerRemoveOptions{Force: true}).Return(nil).Once()
+
+	moved, _, err := c.MoveContainer(container, target, auth)
+	assert.NoError(t, err)
+	assert.Equal(t, "new-id", moved.ID)
+	targetClient.AssertCalled(t, "ImagePull", mock.Anything, "postgres", types.ImagePullOptions{RegistryAuth: encodedAuth})
+}
+
+func TestNewPlacement(t *testing.T) {
+	n := &node.Node{
+		ID:     "node-id",
+		Name:   "node",
+		Labels: map[string]string{"region": "us-east", "storage": "ssd", "zone": "a"},
+		Containers: cluster.Containers{{
+			Container: types.Container{ID: "redis-id", Names: []string{"/redis"}},
+		}},
+	}
+	config := cluster.BuildContainerConfig(containertypes.Config{Env: []string{
+		"constraint:region==us-east",
+		"constraint:storage|disk==ssd",
+		"constraint:storage==~hdd",
+		"constraint:containers<5",
+		"constraint:node!=other",
+		"constraint:zone<=5",
+		"affinity:container==redis",
+		"affinity:container==~mysql",
+	}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{})
+
+	placement := newPlacement(config, n)
+	assert.Equal(t, []string{"region==us-east", "storage|disk==ssd", "containers<5", "node!=other"}, placement.Constraints)
+	assert.Equal(t, []string{"container==redis"}, placement.Affinities)
+	// the keys computed by swarm are recorded along with the labels
+	assert.Equal(t, map[string]string{
+		"region":     "us-east",
+		"storage":    "ssd",
+		"containers": "1",
+		"node":       "node-id,node",
+	}, placement.Labels)
+}
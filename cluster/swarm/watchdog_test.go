@@ -0,0 +1,279 @@
+package swarm
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	containertypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	networktypes "github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/registry"
+	engineapimock "github.com/docker/swarm/api/mockclient"
+	"github.com/docker/swarm/cluster"
+	"github.com/docker/swarm/scheduler"
+	"github.com/docker/swarm/scheduler/filter"
+	"github.com/docker/swarm/scheduler/strategy"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// callRecorder records the order of mocked API calls, which are made from
+// the watchdog goroutines.
+type callRecorder struct {
+	sync.Mutex
+	calls []string
+}
+
+func (r *callRecorder) record(call string) func(mock.Arguments) {
+	return func(mock.Arguments) {
+		r.Lock()
+		defer r.Unlock()
+		r.calls = append(r.calls, call)
+	}
+}
+
+func (r *callRecorder) get() []string {
+	r.Lock()
+	defer r.Unlock()
+	return append([]string{}, r.calls...)
+}
+
+// eventRecorder records the rescheduled events handled by the cluster.
+type eventRecorder struct {
+	sync.Mutex
+	events []*cluster.Event
+}
+
+func (r *eventRecorder) Handle(e *cluster.Event) error {
+	if e.Status != "rescheduled" {
+		return nil
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.events = append(r.events, e)
+	return nil
+}
+
+func (r *eventRecorder) get() []*cluster.Event {
+	r.Lock()
+	defer r.Unlock()
+	return append([]*cluster.Event{}, r.events...)
+}
+
+// newWatchdogCluster returns a cluster watched by a watchdog, with two
+// mocked engines.
+func newWatchdogCluster(t *testing.T) (*Cluster, []*cluster.Engine, []*engineapimock.MockClient) {
+	strat, err := strategy.New("spread")
+	assert.NoError(t, err)
+	filters, err := filter.New([]string{"constraint"})
+	assert.NoError(t, err)
+	c := &Cluster{
+		ClusterEventHandlers: cluster.NewClusterEventHandlers(),
+		engines:              make(map[string]*cluster.Engine),
+		pendingContainers:    make(map[string]*pendingContainer),
+		scheduler:            scheduler.New(strat, filters),
+	}
+	cluster.NewWatchdog(c)
+
+	var engines []*cluster.Engine
+	var clients []*engineapimock.MockClient
+	for _, id := range []string{"engine-1", "engine-2"} {
+		engine, apiClient := newMockEngine(id)
+		engine.Memory, engine.Cpus = 1024, 2
+		engine.Labels["ostype"] = "linux"
+		assert.NoError(t, engine.RegisterEventHandler(c))
+		// creating a container adds an ostype constraint to its config
+		apiClient.On("DistributionInspect", mock.Anything, mock.Anything, mock.Anything).Return(registry.DistributionInspect{Platforms: []v1.Platform{{OS: "linux"}}}, nil)
+		c.engines[engine.ID] = engine
+		engines = append(engines, engine)
+		clients = append(clients, apiClient)
+	}
+	return c, engines, clients
+}
+
+func watchdogContainerInspect(name string, config *cluster.ContainerConfig) types.ContainerJSON {
+	// refreshing the container rebuilds its config from the inspected one
+	config = config.Copy()
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			Name:       name,
+			HostConfig: &config.HostConfig,
+			State:      &types.ContainerState{},
+		},
+		Config:          &config.Config,
+		NetworkSettings: &types.NetworkSettings{},
+	}
+}
+
+// addUnhealthyContainer adds a running container named web, with an
+// on-unhealthy reschedule policy, to engine.
+func addUnhealthyContainer(engine *cluster.Engine) *cluster.ContainerConfig {
+	config := cluster.BuildContainerConfig(containertypes.Config{
+		Image:  "redis",
+		Env:    []string{"reschedule:on-unhealthy"},
+		Labels: map[string]string{"com.docker.swarm.id": "swarm-id"},
+	}, containertypes.HostConfig{}, networktypes.NetworkingConfig{})
+	engine.AddContainer(&cluster.Container{
+		Container: types.Container{ID: "old-id", Names: []string{"/web"}},
+		Config:    config,
+		Engine:    engine,
+		Info: types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{
+				Name:  "/web",
+				State: &types.ContainerState{Running: true},
+			},
+		},
+	})
+	return config
+}
+
+func unhealthyEvent(engine *cluster.Engine) *cluster.Event {
+	return &cluster.Event{
+		Message: events.Message{
+			Type:   "container",
+			Action: "health_status: unhealthy",
+			Actor:  events.Actor{ID: "old-id"},
+		},
+		Engine: engine,
+	}
+}
+
+func TestRescheduleUnhealthyContainer(t *testing.T) {
+	c, engines, clients := newWatchdogCluster(t)
+	config := addUnhealthyContainer(engines[0])
+	var events eventRecorder
+	assert.NoError(t, c.RegisterEventHandler(&events))
+
+	var r callRecorder
+	// the old container is renamed out of the way and removed last
+	renamed := watchdogContainerInspect("/web-unhealthy-old-id", config)
+	clients[0].On("ContainerRename", mock.Anything, "old-id", "web-unhealthy-old-id").Return(nil).Run(r.record("rename")).Once()
+	clients[0].On("ContainerList", mock.Anything, mock.AnythingOfType("ContainerListOptions")).Return([]types.Container{{ID: "old-id", Names: []string{"/web-unhealthy-old-id"}}}, nil)
+	clients[0].On("ContainerInspect", mock.Anything, "old-id").Return(renamed, nil)
+	clients[0].On("ContainerRemove", mock.Anything, "old-id", types.ContainerRemoveOptions{Force: true}).Return(nil).Run(r.record("remove")).Once()
+
+	// spread picks the other engine, which runs no container
+	clients[1].On("ContainerCreate", mock.Anything, mock.Anything, mock.Anything, mock.Anything, "web").Return(containertypes.ContainerCreateCreatedBody{ID: "new-id"}, nil).Run(r.record("create")).Once()
+	clients[1].On("ContainerList", mock.Anything, mock.AnythingOfType("ContainerListOptions")).Return([]types.Container{{ID: "new-id", Names: []string{"/web"}}}, nil)
+	clients[1].On("ContainerInspect", mock.Anything, "new-id").Return(watchdogContainerInspect("/web", config), nil)
+	clients[1].On("ContainerStart", mock.Anything, "new-id", types.ContainerStartOptions{}).Return(nil).Run(r.record("start")).Once()
+
+	assert.NoError(t, c.Handle(unhealthyEvent(engines[0])))
+	assert.True(t, waitFor(func() bool { return len(r.get()) == 4 }))
+	assert.Equal(t, []string{"rename", "create", "remove", "start"}, r.get())
+	// scheduling left the config of the old container alone
+	assert.Equal(t, config.Labels, renamed.Config.Labels)
+	assert.Nil(t, engines[0].Containers().Get("old-id"))
+	assert.NotNil(t, engines[1].Containers().Get("new-id"))
+
+	// the replacement is announced through the cluster handlers
+	if assert.Len(t, events.get(), 1) {
+		e := events.get()[0]
+		assert.Equal(t, "new-id", e.Actor.ID)
+		assert.Equal(t, engines[1], e.Engine)
+		assert.Equal(t, "engine-1", e.Actor.Attributes["previous_node"])
+		assert.Equal(t, "old-id", e.Actor.Attributes["previous_container"])
+	}
+}
+
+func TestRescheduleContainersOnNodeFailure(t *testing.T) {
+	c, engines, clients := newWatchdogCluster(t)
+	var events eventRecorder
+	assert.NoError(t, c.RegisterEventHandler(&events))
+
+	config := cluster.BuildContainerConfig(containertypes.Config{
+		Image:  "redis",
+		Env:    []string{"reschedule:on-node-failure"},
+		Labels: map[string]string{"com.docker.swarm.id": "swarm-id"},
+	}, containertypes.HostConfig{}, networktypes.NetworkingConfig{})
+	engines[0].AddContainer(&cluster.Container{
+		Container: types.Container{ID: "old-id", Names: []string{"/web"}},
+		Config:    config,
+		Engine:    engines[0],
+		Info: types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{
+				Name:  "/web",
+				State: &types.ContainerState{Running: true},
+			},
+		},
+	})
+
+	var r callRecorder
+	clients[1].On("ContainerCreate", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(containertypes.ContainerCreateCreatedBody{ID: "new-id"}, nil).Run(r.record("create")).Once()
+	clients[1].On("ContainerList", mock.Anything, mock.AnythingOfType("ContainerListOptions")).Return([]types.Container{{ID: "new-id", Names: []string{"/web"}}}, nil)
+	clients[1].On("ContainerInspect", mock.Anything, "new-id").Return(watchdogContainerInspect("/web", config), nil)
+	clients[1].On("ContainerStart", mock.Anything, "new-id", types.ContainerStartOptions{}).Return(nil).Run(r.record("start")).Once()
+
+	// the engine leaves the cluster, as removeEngine does
+	delete(c.engines, engines[0].ID)
+	engines[0].Disconnect()
+
+	assert.True(t, waitFor(func() bool { return len(r.get()) == 2 }))
+	assert.Equal(t, []string{"create", "start"}, r.get())
+	assert.NotNil(t, engines[1].Containers().Get("new-id"))
+
+	if assert.Len(t, events.get(), 1) {
+		e := events.get()[0]
+		assert.Equal(t, "swarm", e.From)
+		assert.Equal(t, "new-id", e.Actor.ID)
+		assert.Equal(t, engines[1], e.Engine)
+		assert.Equal(t, "swarm-id", e.Actor.Attributes["com.docker.swarm.id"])
+		assert.Equal(t, "engine-2", e.Actor.Attributes["node"])
+		assert.Equal(t, "engine-1", e.Actor.Attributes["previous_node"])
+		assert.Equal(t, "old-id", e.Actor.Attributes["previous_container"])
+	}
+}
+
+func TestRescheduleUnhealthyContainerLoad(t *testing.T) {
+	c, engines, clients := newWatchdogCluster(t)
+	config := addUnhealthyContainer(engines[0])
+
+	clients[0].On("ContainerRename", mock.Anything, "old-id", "web-unhealthy-old-id").Return(nil)
+	clients[0].On("ContainerList", mock.Anything, mock.AnythingOfType("ContainerListOptions")).Return([]types.Container{{ID: "old-id", Names: []string{"/web-unhealthy-old-id"}}}, nil)
+	clients[0].On("ContainerInspect", mock.Anything, "old-id").Return(watchdogContainerInspect("/web-unhealthy-old-id", config), nil)
+	clients[0].On("ContainerRemove", mock.Anything, "old-id", types.ContainerRemoveOptions{Force: true}).Return(nil)
+	clients[1].On("ContainerCreate", mock.Anything, mock.Anything, mock.Anything, mock.Anything, "web").Return(containertypes.ContainerCreateCreatedBody{ID: "new-id"}, nil)
+	clients[1].On("ContainerList", mock.Anything, mock.AnythingOfType("ContainerListOptions")).Return([]types.Container{{ID: "new-id", Names: []string{"/web"}}}, nil)
+	clients[1].On("ContainerInspect", mock.Anything, "new-id").Return(watchdogContainerInspect("/web", config), nil)
+
+	var r callRecorder
+	clients[1].On("ContainerStart", mock.Anything, "new-id", types.ContainerStartOptions{}).Return(nil).Run(r.record("start"))
+
+	assert.Equal(t, int64(0), engines[1].RescheduleLoad())
+	assert.NoError(t, c.Handle(unhealthyEvent(engines[0])))
+	assert.True(t, waitFor(func() bool { return len(r.get()) == 1 }))
+
+	// the load is counted against the engine which took the container over
+	assert.Equal(t, int64(0), engines[0].RescheduleLoad())
+	assert.Equal(t, int64(1), engines[1].RescheduleLoad())
+}
+
+func TestRescheduleUnhealthyContainerCreateFailure(t *testing.T) {
+	c, engines, clients := newWatchdogCluster(t)
+	config := addUnhealthyContainer(engines[0])
+
+	var r callRecorder
+	renamed := watchdogContainerInspect("/web-unhealthy-old-id", config)
+	clients[0].On("ContainerRename", mock.Anything, "old-id", "web-unhealthy-old-id").Return(nil).Run(r.record("rename")).Once()
+	clients[0].On("ContainerList", mock.Anything, mock.AnythingOfType("ContainerListOptions")).Return([]types.Container{{ID: "old-id", Names: []string{"/web-unhealthy-old-id"}}}, nil).Once()
+	clients[0].On("ContainerInspect", mock.Anything, "old-id").Return(renamed, nil).Once()
+	clients[0].On("ContainerRename", mock.Anything, "old-id", "web").Return(nil).Run(r.record("restore")).Once()
+	clients[0].On("ContainerList", mock.Anything, mock.AnythingOfType("ContainerListOptions")).Return([]types.Container{{ID: "old-id", Names: []string{"/web"}}}, nil)
+	clients[0].On("ContainerInspect", mock.Anything, "old-id").Return(watchdogContainerInspect("/web", config), nil)
+
+	clients[1].On("ContainerCreate", mock.Anything, mock.Anything, mock.Anything, mock.Anything, "web").Return(containertypes.ContainerCreateCreatedBody{}, fmt.Errorf("no space left on device")).Run(r.record("create")).Once()
+
+	assert.NoError(t, c.Handle(unhealthyEvent(engines[0])))
+	assert.True(t, waitFor(func() bool { return len(r.get()) == 3 }))
+	// the unhealthy container is kept, under its own name and unchanged
+	assert.Equal(t, []string{"rename", "create", "restore"}, r.get())
+	assert.Equal(t, config.Labels, renamed.Config.Labels)
+	clients[0].AssertNotCalled(t, "ContainerRemove", mock.Anything, "old-id", mock.Anything)
+	old := engines[0].Containers().Get("old-id")
+	if assert.NotNil(t, old) {
+		assert.Equal(t, "/web", old.Info.Name)
+	}
+}
@@ -1,22 +1,55 @@
 package cluster
 
 import (
+	"strings"
 	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/pkg/stringid"
 	"context"
 )
 
+const (
+	// minUnhealthyRescheduleInterval is the delay before a container
+	// rescheduled because it was unhealthy may be rescheduled again. It
+	// doubles with each attempt, up to maxUnhealthyRescheduleInterval.
+	minUnhealthyRescheduleInterval = 10 * time.Second
+	maxUnhealthyRescheduleInterval = 5 * time.Minute
+)
+
+// rescheduleBackoff tracks the unhealthy reschedules of a container.
+type rescheduleBackoff struct {
+	interval time.Duration
+	next     time.Time
+}
+
 // Watchdog listens to cluster events and handles container rescheduling
 type Watchdog struct {
 	sync.Mutex
 	cluster Cluster
+	// unhealthy holds the reschedule backoff of unhealthy containers,
+	// indexed by swarm ID, or container ID for non-swarm containers.
+	unhealthy map[string]*rescheduleBackoff
 }
 
 // Handle handles cluster callbacks
 func (w *Watchdog) Handle(e *Event) error {
+	// Containers failing their healthcheck may be rescheduled.
+	if e.Type == "container" && e.Action == "health_status: unhealthy" && e.Engine != nil {
+		go w.rescheduleUnhealthyContainer(e.Engine, e.Actor.ID)
+		return nil
+	}
+	if e.Type == "container" && e.Action == "health_status: healthy" {
+		key := e.Actor.Attributes[SwarmLabelNamespace+".id"]
+		if key == "" {
+			key = e.Actor.ID
+		}
+		go w.resetUnhealthyBackoff(key)
+		return nil
+	}
+
 	// Skip non-swarm events.
 	if e.From != "swarm" {
 		return nil
@@ -119,11 +152,7 @@ func (w *Watchdog) rescheduleContainers(e *Engine) {
 
 						// When connecting to this network later, avoid
 						// requesting the same IP address.
-						globalNetworks[networkName].IPAddress = ""
-						if globalNetworks[networkName].IPAMConfig != nil {
-							globalNetworks[networkName].IPAMConfig.IPv4Address = ""
-							globalNetworks[networkName].IPAMConfig.IPv6Address = ""
-						}
+						clearEndpointAddresses(globalNetworks[networkName])
 					}
 				}
 			}
@@ -131,17 +160,7 @@ func (w *Watchdog) rescheduleContainers(e *Engine) {
 
 		// Clear out the network configs that we're going to reattach
 		// later.
-		endpointsConfig := map[string]*network.EndpointSettings{}
-		for k, v := range c.Config.NetworkingConfig.EndpointsConfig {
-			net := w.cluster.Networks().Uniq().Get(v.NetworkID)
-			if net != nil && (net.Scope == "global" || net.Scope == "swarm") {
-				// These networks are already in globalNetworks
-				// and thus will be reattached later.
-				continue
-			}
-			endpointsConfig[k] = v
-		}
-		c.Config.NetworkingConfig.EndpointsConfig = endpointsConfig
+		c.Config.NetworkingConfig.EndpointsConfig = w.localEndpointsConfig(c.Config)
 		newContainer, err := w.cluster.CreateContainer(c.Config, c.Info.Name, nil)
 		if err != nil {
 			log.Errorf("Failed to reschedule container %s: %v", c.ID, err)
@@ -150,19 +169,11 @@ func (w *Watchdog) rescheduleContainers(e *Engine) {
 			continue
 		}
 
-		// Docker create command cannot create a container with multiple networks
-		// see https://github.com/docker/docker/issues/17750
-		// Add the global networks one by one
-		for networkName, endpoint := range globalNetworks {
-			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-			defer cancel()
-			err = newContainer.Engine.apiClient.NetworkConnect(ctx, networkName, name, endpoint)
-			if err != nil {
-				log.Warnf("Failed to connect network %s to container %s: %v", networkName, name, err)
-			}
-		}
+		connectGlobalNetworks(newContainer, name, globalNetworks)
 
 		log.Infof("Rescheduled container %s from %s to %s as %s", c.ID, c.Engine.Name, newContainer.Engine.Name, newContainer.ID)
+		newContainer.Engine.incRescheduleLoad()
+		newContainer.Engine.emitRescheduledEvent(newContainer, c, c.Engine)
 		if c.Info.State.Running {
 			log.Infof("Container %s was running, starting container %s", c.ID, newContainer.ID)
 			if err := w.cluster.StartContainer(newContainer); err != nil {
@@ -172,11 +183,181 @@ func (w *Watchdog) rescheduleContainers(e *Engine) {
 	}
 }
 
+// rescheduleUnhealthyContainer replaces a container failing its healthcheck
+// with a new one, if it has an "on-unhealthy" reschedule policy. The engine
+// being healthy, the old container is renamed out of the way and only removed
+// once its replacement has been created. Attempts are rate limited, so that
+// a container which is unhealthy from the start isn't recreated in a loop.
+func (w *Watchdog) rescheduleUnhealthyContainer(e *Engine, id string) {
+	w.Lock()
+	defer w.Unlock()
+
+	c := e.Containers().Get(id)
+	if c == nil || !c.Config.HasReschedulePolicy("on-unhealthy") {
+		return
+	}
+
+	name := strings.TrimPrefix(c.Info.Name, "/")
+	if name == "" {
+		log.Errorf("container %s has no name", c.ID)
+		return
+	}
+
+	if next, ok := w.allowUnhealthyReschedule(c); !ok {
+		log.Debugf("Container %s is unhealthy - not rescheduling it before %s", c.ID, next)
+		return
+	}
+
+	log.Debugf("Container %s is unhealthy - rescheduling it", c.ID)
+
+	// Free the name for the new container, but keep the old one until
+	// the new one exists.
+	oldName := name + "-unhealthy-" + stringid.TruncateID(c.ID)
+	if err := w.cluster.RenameContainer(c, oldName); err != nil {
+		log.Errorf("Failed to rename unhealthy container %s: %v", c.ID, err)
+		return
+	}
+
+	// Global networks can't be given at create time, and the old container
+	// still holds its endpoints. They are connected once it's gone.
+	globalNetworks := w.globalNetworks(c)
+	// Scheduling adds constraints to the config, don't let them leak into
+	// the old container.
+	config := c.Config.Copy()
+	config.NetworkingConfig.EndpointsConfig = w.localEndpointsConfig(c.Config)
+
+	newContainer, err := w.cluster.CreateContainer(config, name, nil)
+	if err != nil {
+		log.Errorf("Failed to reschedule container %s: %v", c.ID, err)
+		if err := w.cluster.RenameContainer(c, name); err != nil {
+			log.Errorf("Failed to restore the name of unhealthy container %s: %v", c.ID, err)
+		}
+		return
+	}
+
+	if err := e.RemoveContainer(c, true, false); err != nil {
+		log.Errorf("Failed to remove unhealthy container %s: %v", c.ID, err)
+		// The old endpoints are still in use, don't request their addresses.
+		for _, endpoint := range globalNetworks {
+			clearEndpointAddresses(endpoint)
+		}
+	}
+	connectGlobalNetworks(newContainer, name, globalNetworks)
+
+	log.Infof("Rescheduled unhealthy container %s from %s to %s as %s", c.ID, e.Name, newContainer.Engine.Name, newContainer.ID)
+	newContainer.Engine.incRescheduleLoad()
+	newContainer.Engine.emitRescheduledEvent(newContainer, c, e)
+	if err := w.cluster.StartContainer(newContainer); err != nil {
+		log.Errorf("Failed to start rescheduled container %s: %v", newContainer.ID, err)
+	}
+}
+
+// allowUnhealthyReschedule reports whether the unhealthy container c may be
+// rescheduled now and, if so, records the attempt. Otherwise it returns when
+// the next attempt is allowed.
+func (w *Watchdog) allowUnhealthyReschedule(c *Container) (time.Time, bool) {
+	now := time.Now()
+	for key, b := range w.unhealthy {
+		// forget containers which have been quiet for long enough
+		if now.Sub(b.next) > maxUnhealthyRescheduleInterval {
+			delete(w.unhealthy, key)
+		}
+	}
+
+	key := c.Config.SwarmID()
+	if key == "" {
+		key = c.ID
+	}
+	b, ok := w.unhealthy[key]
+	if !ok {
+		w.unhealthy[key] = &rescheduleBackoff{
+			interval: minUnhealthyRescheduleInterval,
+			next:     now.Add(minUnhealthyRescheduleInterval),
+		}
+		return time.Time{}, true
+	}
+	if now.Before(b.next) {
+		return b.next, false
+	}
+	b.interval *= 2
+	if b.interval > maxUnhealthyRescheduleInterval {
+		b.interval = maxUnhealthyRescheduleInterval
+	}
+	b.next = now.Add(b.interval)
+	return time.Time{}, true
+}
+
+// resetUnhealthyBackoff forgets the reschedules of a container once it
+// passes its healthcheck.
+func (w *Watchdog) resetUnhealthyBackoff(key string) {
+	w.Lock()
+	defer w.Unlock()
+	delete(w.unhealthy, key)
+}
+
+// globalNetworks returns the endpoints of container c on global or swarm
+// scoped networks, indexed by network name.
+func (w *Watchdog) globalNetworks(c *Container) map[string]*network.EndpointSettings {
+	globalNetworks := make(map[string]*network.EndpointSettings)
+	if c.Info.NetworkSettings == nil {
+		return globalNetworks
+	}
+	clusterNetworks := w.cluster.Networks().Uniq()
+	for networkName, endpoint := range c.Info.NetworkSettings.Networks {
+		net := clusterNetworks.Get(endpoint.NetworkID)
+		if net != nil && (net.Scope == "global" || net.Scope == "swarm") {
+			globalNetworks[networkName] = endpoint
+		}
+	}
+	return globalNetworks
+}
+
+// localEndpointsConfig returns the endpoints config of config without the
+// global or swarm scoped networks, which are connected after create.
+func (w *Watchdog) localEndpointsConfig(config *ContainerConfig) map[string]*network.EndpointSettings {
+	clusterNetworks := w.cluster.Networks().Uniq()
+	endpointsConfig := map[string]*network.EndpointSettings{}
+	for k, v := range config.NetworkingConfig.EndpointsConfig {
+		net := clusterNetworks.Get(v.NetworkID)
+		if net != nil && (net.Scope == "global" || net.Scope == "swarm") {
+			continue
+		}
+		endpointsConfig[k] = v
+	}
+	return endpointsConfig
+}
+
+// connectGlobalNetworks connects container, named name, to networks.
+func connectGlobalNetworks(container *Container, name string, networks map[string]*network.EndpointSettings) {
+	// Docker create command cannot create a container with multiple networks
+	// see https://github.com/docker/docker/issues/17750
+	// Add the global networks one by one
+	for networkName, endpoint := range networks {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := container.Engine.apiClient.NetworkConnect(ctx, networkName, name, endpoint)
+		cancel()
+		if err != nil {
+			log.Warnf("Failed to connect network %s to container %s: %v", networkName, name, err)
+		}
+	}
+}
+
+// clearEndpointAddresses avoids requesting the same IP address when
+// connecting endpoint again.
+func clearEndpointAddresses(endpoint *network.EndpointSettings) {
+	endpoint.IPAddress = ""
+	if endpoint.IPAMConfig != nil {
+		endpoint.IPAMConfig.IPv4Address = ""
+		endpoint.IPAMConfig.IPv6Address = ""
+	}
+}
+
 // NewWatchdog creates a new watchdog
 func NewWatchdog(cluster Cluster) *Watchdog {
 	log.Debugf("Watchdog enabled")
 	w := &Watchdog{
-		cluster: cluster,
+		cluster:   cluster,
+		unhealthy: make(map[string]*rescheduleBackoff),
 	}
 	cluster.RegisterEventHandler(w)
 	return w
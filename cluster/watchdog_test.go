@@ -0,0 +1,55 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnhealthyRescheduleBackoff(t *testing.T) {
+	w := &Watchdog{unhealthy: make(map[string]*rescheduleBackoff)}
+	c := &Container{
+		Container: types.Container{ID: "container-id"},
+		Config: BuildContainerConfig(container.Config{
+			Labels: map[string]string{"com.docker.swarm.id": "swarm-id"},
+		}, container.HostConfig{}, network.NetworkingConfig{}),
+	}
+
+	_, ok := w.allowUnhealthyReschedule(c)
+	assert.True(t, ok)
+
+	// a second attempt has to wait
+	next, ok := w.allowUnhealthyReschedule(c)
+	assert.False(t, ok)
+	assert.True(t, next.After(time.Now()))
+
+	// once allowed again, the interval doubles
+	w.unhealthy["swarm-id"].next = time.Now()
+	_, ok = w.allowUnhealthyReschedule(c)
+	assert.True(t, ok)
+	assert.Equal(t, 2*minUnhealthyRescheduleInterval, w.unhealthy["swarm-id"].interval)
+
+	// up to a maximum
+	for i := 0; i < 10; i++ {
+		w.unhealthy["swarm-id"].next = time.Now()
+		w.allowUnhealthyReschedule(c)
+	}
+	assert.Equal(t, maxUnhealthyRescheduleInterval, w.unhealthy["swarm-id"].interval)
+
+	// passing the healthcheck resets it
+	w.resetUnhealthyBackoff("swarm-id")
+	_, ok = w.allowUnhealthyReschedule(c)
+	assert.True(t, ok)
+	assert.Equal(t, minUnhealthyRescheduleInterval, w.unhealthy["swarm-id"].interval)
+
+	// so does staying quiet for long enough
+	w.unhealthy["swarm-id"].next = time.Now().Add(-2 * maxUnhealthyRescheduleInterval)
+	w.unhealthy["swarm-id"].interval = maxUnhealthyRescheduleInterval
+	_, ok = w.allowUnhealthyReschedule(c)
+	assert.True(t, ok)
+	assert.Equal(t, minUnhealthyRescheduleInterval, w.unhealthy["swarm-id"].interval)
+}
@@ -34,9 +34,14 @@ func (f *AffinityFilter) Filter(config *cluster.ContainerConfig, nodes []*node.N
 		candidates := []*node.Node{}
 		for _, node := range nodes {
 			switch affinity.key {
-			case "container":
+			case "container", "running-container":
+				// "running-container" only considers the running containers.
+				nodeContainers := node.Containers
+				if affinity.key == "running-container" {
+					nodeContainers = nodeContainers.FilterByState("running")
+				}
 				containers := []string{}
-				for _, container := range node.Containers {
+				for _, container := range nodeContainers {
 					if len(container.Names) > 0 {
 						containers = append(containers, container.ID, strings.TrimPrefix(container.Names[0], "/"))
 					}
@@ -53,6 +58,11 @@ func (f *AffinityFilter) Filter(config *cluster.ContainerConfig, nodes []*node.N
 						repo, _ := cluster.ParseRepositoryTag(tag)
 						images = append(images, repo)
 					}
+					// images pinned by digest (ex. nginx@sha256:...)
+					for _, digest := range image.RepoDigests {
+						repo, _ := cluster.ParseRepositoryTag(digest)
+						images = append(images, digest, repo)
+					}
 				}
 				if affinity.Match(images...) {
 					candidates = append(candidates, node)
@@ -60,7 +70,9 @@ func (f *AffinityFilter) Filter(config *cluster.ContainerConfig, nodes []*node.N
 			default:
 				labels := []string{}
 				for _, container := range node.Containers {
-					labels = append(labels, container.Labels[affinity.key])
+					for _, key := range affinity.keys() {
+						labels = append(labels, container.Labels[key])
+					}
 				}
 				if affinity.Match(labels...) {
 					candidates = append(candidates, node)
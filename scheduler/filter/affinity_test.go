@@ -262,3 +262,151 @@ func TestAffinityFilterLabels(t *testing.T) {
 	assert.Len(t, result, 1)
 	assert.Equal(t, result[0], nodes[0])
 }
+
+func TestAffinityFilterContainerLabels(t *testing.T) {
+	var (
+		f     = AffinityFilter{}
+		nodes = []*node.Node{
+			{
+				ID:   "node-0-id",
+				Name: "node-0-name",
+				Addr: "node-0",
+				Containers: []*cluster.Container{
+					{Container: types.Container{
+						ID:     "container-n0-id",
+						Names:  []string{"/container-n0-name"},
+						Labels: map[string]string{"tier": "web"},
+					}},
+				},
+			},
+			{
+				ID:   "node-1-id",
+				Name: "node-1-name",
+				Addr: "node-1",
+				Containers: []*cluster.Container{
+					{Container: types.Container{
+						ID:     "container-n1-id",
+						Names:  []string{"/container-n1-name"},
+						Labels: map[string]string{"tier": "cache"},
+					}},
+				},
+			},
+		}
+		result []*node.Node
+		err    error
+	)
+
+	// Any key other than container and image matches the labels of the
+	// containers running on the node.
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"affinity:tier==cache"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.NoError(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, result[0], nodes[1])
+
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"affinity:tier!=cache"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.NoError(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, result[0], nodes[0])
+
+	_, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"affinity:tier==db"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.Error(t, err)
+}
+
+func TestAffinityFilterImageDigest(t *testing.T) {
+	var (
+		f       = AffinityFilter{}
+		digest0 = "sha256:bc8813ea7b3603864987522f02a76101c17ad122e1c46d790efc0fca78ca7bfb"
+		digest1 = "sha256:0f1a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c4d5e6f708192a3b4c5d6e7f8"
+		nodes   = []*node.Node{
+			{
+				ID:   "node-0-id",
+				Name: "node-0-name",
+				Addr: "node-0",
+				Images: []*cluster.Image{{ImageSummary: types.ImageSummary{
+					ID:          "image-0-id",
+					RepoDigests: []string{"nginx@" + digest0},
+				}}},
+			},
+			{
+				ID:   "node-1-id",
+				Name: "node-1-name",
+				Addr: "node-1",
+				Images: []*cluster.Image{{ImageSummary: types.ImageSummary{
+					ID:          "image-1-id",
+					RepoDigests: []string{"nginx@" + digest1},
+				}}},
+			},
+		}
+		result []*node.Node
+		err    error
+	)
+
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"affinity:image==nginx@" + digest0}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.NoError(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, result[0], nodes[0])
+
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"affinity:image!=nginx@" + digest0}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.NoError(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, result[0], nodes[1])
+
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"affinity:image==nginx"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"affinity:image==nginx@sha256:0000"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.Error(t, err)
+	assert.Len(t, result, 0)
+}
+
+func TestAffinityFilterRunningContainer(t *testing.T) {
+	var (
+		f         = AffinityFilter{}
+		container = func(id string, running bool) *cluster.Container {
+			return &cluster.Container{
+				Container: types.Container{ID: id + "-id", Names: []string{"/" + id}},
+				Info: types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{
+					State: &types.ContainerState{Running: running, StartedAt: "2016-01-01T00:00:00Z"},
+				}},
+			}
+		}
+		nodes = []*node.Node{
+			{
+				ID:         "node-0-id",
+				Name:       "node-0-name",
+				Addr:       "node-0",
+				Containers: []*cluster.Container{container("redis", false)},
+			},
+			{
+				ID:         "node-1-id",
+				Name:       "node-1-name",
+				Addr:       "node-1",
+				Containers: []*cluster.Container{container("redis", true)},
+			},
+		}
+		result []*node.Node
+		err    error
+	)
+
+	// Any redis container attracts the new container.
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"affinity:container==redis"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+
+	// Only the running redis container attracts the new container.
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"affinity:running-container==redis"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.NoError(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, result[0], nodes[1])
+
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"affinity:running-container!=redis"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.NoError(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, result[0], nodes[0])
+
+	// Once stopped, the redis container no longer attracts it.
+	nodes[1].Containers[0].Info.State.Running = false
+	_, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"affinity:running-container==redis"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.Error(t, err)
+}
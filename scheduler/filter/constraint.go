@@ -2,6 +2,7 @@ package filter
 
 import (
 	"fmt"
+	"strconv"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/docker/swarm/cluster"
@@ -30,19 +31,9 @@ func (f *ConstraintFilter) Filter(config *cluster.ContainerConfig, nodes []*node
 		}
 		log.Debugf("matching constraint: %s%s%s (soft=%t)", constraint.key, OPERATORS[constraint.operator], constraint.value, constraint.isSoft)
 
-		candidates := []*node.Node{}
-		for _, node := range nodes {
-			switch constraint.key {
-			case "node":
-				// "node" label is a special case pinning a container to a specific node.
-				if constraint.Match(node.ID, node.Name) {
-					candidates = append(candidates, node)
-				}
-			default:
-				if constraint.Match(node.Labels[constraint.key]) {
-					candidates = append(candidates, node)
-				}
-			}
+		candidates, rejections := filterExprs([]expr{constraint}, nodes, constraintValues)
+		for _, rejection := range rejections {
+			log.Debugf("node %s rejected by constraint %s: %s", rejection.Node.Name, rejection.Expr, rejection.Reason)
 		}
 		if len(candidates) == 0 {
 			return nil, fmt.Errorf("unable to find a node that satisfies the constraint %s%s%s", constraint.key, OPERATORS[constraint.operator], constraint.value)
@@ -52,6 +43,66 @@ func (f *ConstraintFilter) Filter(config *cluster.ContainerConfig, nodes []*node
 	return nodes, nil
 }
 
+// constraintValues returns the values of the node the constraint is matched
+// against. With several keys (ex. gpu|fpga==true), only the labels set on
+// the node are used, so the constraint is met if any of them matches.
+func constraintValues(constraint expr, node *node.Node) []string {
+	values := []string{}
+	for _, key := range constraint.keys() {
+		values = append(values, ConstraintValues(key, node)...)
+	}
+	if len(values) == 0 {
+		// none of the labels is set
+		values = append(values, "")
+	}
+	return values
+}
+
+// ConstraintKeys returns the keys a constraint refers to (ex. gpu and fpga
+// for gpu|fpga==true).
+func ConstraintKeys(constraint string) ([]string, error) {
+	exprs, err := parseExprs([]string{constraint})
+	if err != nil {
+		return nil, err
+	}
+	return exprs[0].keys(), nil
+}
+
+// ConstraintValues returns the values of the node a constraint key is matched
+// against, none if the key is neither set nor computed. A label set on the
+// node takes precedence over the keys computed by swarm (ex. containers), so
+// that existing constraints on it keep working.
+func ConstraintValues(key string, node *node.Node) []string {
+	if value, ok := node.Labels[key]; ok {
+		return []string{value}
+	}
+	switch key {
+	case "node":
+		// "node" is a special case pinning a container to a specific node.
+		return []string{node.ID, node.Name}
+	case "containers":
+		// "containers" is the number of containers on the node.
+		return []string{strconv.Itoa(len(node.Containers))}
+	case "volumedriver":
+		// drivers are the plugins installed on the node, any of them
+		// may match.
+		return node.Plugins.Volume
+	case "networkdriver":
+		return node.Plugins.Network
+	case "logdriver":
+		return node.Plugins.Log
+	case "reschedule-load":
+		// "reschedule-load" is the number of containers rescheduled
+		// onto the node.
+		return []string{strconv.FormatInt(node.RescheduleLoad, 10)}
+	case "freemem":
+		// "freemem" is the memory, overcommit included, not yet
+		// reserved by the containers on the node.
+		return []string{strconv.FormatInt(node.TotalMemory-node.UsedMemory, 10)}
+	}
+	return nil
+}
+
 // GetFilters returns a list of the constraints found in the container config.
 func (f *ConstraintFilter) GetFilters(config *cluster.ContainerConfig) ([]string, error) {
 	allConstraints := []string{}
@@ -3,6 +3,7 @@ package filter
 import (
 	"testing"
 
+	"github.com/docker/docker/api/types"
 	containertypes "github.com/docker/docker/api/types/container"
 	networktypes "github.com/docker/docker/api/types/network"
 	"github.com/docker/swarm/cluster"
@@ -170,6 +171,12 @@ func TestConstraintRegExp(t *testing.T) {
 	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:node!=/node-[01]-id/"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
 	assert.NoError(t, err)
 	assert.Len(t, result, 2)
+
+	// An invalid regular expression is reported instead of never matching.
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:name!=/node[/"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "/node[/")
+	assert.Len(t, result, 0)
 }
 
 func TestFilterRegExpCaseInsensitive(t *testing.T) {
@@ -199,6 +206,16 @@ func TestFilterRegExpCaseInsensitive(t *testing.T) {
 	assert.Equal(t, result[0], nodes[3])
 	assert.Equal(t, result[0].Labels["name"], "aBcDeF")
 
+	// Match with the i modifier, which only applies to a regexp
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{`constraint:name==abcdef/i`}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.Error(t, err)
+	assert.Len(t, result, 0)
+
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{`constraint:name==/^abc/i`}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.NoError(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, result[0], nodes[3])
+
 	// Test ! filter combined with case insensitive
 	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{`constraint:name!=/(?i)abc*/`}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
 	assert.NoError(t, err)
@@ -230,6 +247,167 @@ func TestFilterEquals(t *testing.T) {
 	assert.Equal(t, result[0], nodes[1])
 }
 
+func TestConstraintPlatform(t *testing.T) {
+	var (
+		f      = ConstraintFilter{}
+		nodes  = testFixtures()
+		result []*node.Node
+		err    error
+	)
+
+	nodes[0].Labels["os"] = "linux"
+	nodes[0].Labels["arch"] = "amd64"
+	nodes[1].Labels["os"] = "windows"
+	nodes[1].Labels["arch"] = "amd64"
+	nodes[2].Labels["os"] = "linux"
+	nodes[2].Labels["arch"] = "arm64"
+
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:os==linux", "constraint:arch==amd64"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.NoError(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, result[0], nodes[0])
+
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:os==linux"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+	assert.Equal(t, result[0], nodes[0])
+	assert.Equal(t, result[1], nodes[2])
+
+	// only the linux node matches once the arm one is left out
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:os==linux"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes[:2], true)
+	assert.NoError(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, result[0], nodes[0])
+}
+
+func TestConstraintAlternatives(t *testing.T) {
+	var (
+		f      = ConstraintFilter{}
+		nodes  = testFixtures()
+		result []*node.Node
+		err    error
+	)
+
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:region==us-east|eu"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+	assert.Equal(t, result[0], nodes[1])
+	assert.Equal(t, result[1], nodes[2])
+
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:region!=us-east|eu"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+	assert.Equal(t, result[0], nodes[0])
+	assert.Equal(t, result[1], nodes[3])
+}
+
+func TestConstraintAlternativeKeys(t *testing.T) {
+	var (
+		f      = ConstraintFilter{}
+		nodes  = testFixtures()
+		result []*node.Node
+		err    error
+	)
+
+	// node-0 has a gpu, node-1 a fpga, node-2 both and node-3 none.
+	nodes[0].Labels["gpu"] = "true"
+	nodes[1].Labels["fpga"] = "true"
+	nodes[2].Labels["gpu"] = "false"
+	nodes[2].Labels["fpga"] = "true"
+
+	// Any of the keys set on the node may match.
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:gpu|fpga==true"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.NoError(t, err)
+	assert.Len(t, result, 3)
+	assert.Equal(t, result[0], nodes[0])
+	assert.Equal(t, result[1], nodes[1])
+	assert.Equal(t, result[2], nodes[2])
+
+	// None of the keys set on the node may match.
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:gpu|fpga!=true"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.NoError(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, result[0], nodes[3])
+
+	// At least one of the keys is set.
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:gpu|fpga=="}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.NoError(t, err)
+	assert.Len(t, result, 3)
+
+	// Neither key is set anywhere.
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:tpu|asic==true"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.Error(t, err)
+	assert.Len(t, result, 0)
+}
+
+func TestConstraintContainers(t *testing.T) {
+	var (
+		f      = ConstraintFilter{}
+		nodes  = testFixtures()
+		result []*node.Node
+		err    error
+	)
+
+	// node-0 runs no container, node-1 one, node-2 two and node-3 three.
+	for i, node := range nodes {
+		for j := 0; j < i; j++ {
+			node.Containers = append(node.Containers, &cluster.Container{})
+		}
+	}
+
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:containers<2"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+	assert.Equal(t, result[0], nodes[0])
+	assert.Equal(t, result[1], nodes[1])
+
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:containers>=2"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+	assert.Equal(t, result[0], nodes[2])
+	assert.Equal(t, result[1], nodes[3])
+
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:containers>3"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.Error(t, err)
+	assert.Len(t, result, 0)
+
+	// Numeric comparisons work on labels too.
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:group>1"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.NoError(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, result[0], nodes[2])
+}
+
+func TestConstraintExists(t *testing.T) {
+	var (
+		f      = ConstraintFilter{}
+		nodes  = testFixtures()
+		result []*node.Node
+		err    error
+	)
+
+	// node-0 has a gpu, node-1 has an empty gpu label, the others don't
+	// have one at all.
+	nodes[0].Labels["gpu"] = "nvidia"
+	nodes[1].Labels["gpu"] = ""
+
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:gpu=="}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.NoError(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, result[0], nodes[0])
+
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:gpu!="}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.NoError(t, err)
+	assert.Len(t, result, 3)
+	assert.Equal(t, result[0], nodes[1])
+	assert.Equal(t, result[1], nodes[2])
+	assert.Equal(t, result[2], nodes[3])
+
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:tpu=="}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.Error(t, err)
+	assert.Len(t, result, 0)
+}
+
 func TestUnsupportedOperators(t *testing.T) {
 	var (
 		f      = ConstraintFilter{}
@@ -278,3 +456,121 @@ func TestFilterSoftConstraint(t *testing.T) {
 	assert.Error(t, err)
 	assert.Len(t, result, 0)
 }
+
+func TestConstraintFreeMemory(t *testing.T) {
+	var (
+		f      = ConstraintFilter{}
+		nodes  = testFixtures()[:2]
+		result []*node.Node
+		err    error
+	)
+
+	// node-0 has 3GB free and node-1 only 1GB.
+	nodes[0].TotalMemory = 4 * 1024 * 1024 * 1024
+	nodes[0].UsedMemory = 1 * 1024 * 1024 * 1024
+	nodes[1].TotalMemory = 4 * 1024 * 1024 * 1024
+	nodes[1].UsedMemory = 3 * 1024 * 1024 * 1024
+
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:freemem>2g"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.NoError(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, result[0], nodes[0])
+
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:freemem>=1024m"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:freemem>4g"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.Error(t, err)
+	assert.Len(t, result, 0)
+}
+
+func TestConstraintRescheduleLoad(t *testing.T) {
+	var (
+		f      = ConstraintFilter{}
+		nodes  = testFixtures()[:2]
+		result []*node.Node
+		err    error
+	)
+
+	// node-1 took over 5 containers from failed nodes.
+	nodes[1].RescheduleLoad = 5
+
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:reschedule-load<3"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.NoError(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, result[0], nodes[0])
+
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:reschedule-load<=5"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+}
+
+func TestConstraintPluginDrivers(t *testing.T) {
+	var (
+		f      = ConstraintFilter{}
+		nodes  = testFixtures()[:2]
+		result []*node.Node
+		err    error
+	)
+
+	// only node-1 has the rexray volume plugin.
+	nodes[0].Plugins = types.PluginsInfo{Volume: []string{"local"}, Network: []string{"bridge"}}
+	nodes[1].Plugins = types.PluginsInfo{Volume: []string{"local", "rexray"}, Network: []string{"bridge", "overlay"}}
+
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:volumedriver==rexray"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.NoError(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, result[0], nodes[1])
+
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:volumedriver!=rexray"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.NoError(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, result[0], nodes[0])
+
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:networkdriver==bridge"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+
+	_, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:logdriver==splunk"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.Error(t, err)
+}
+
+func TestConstraintLabelPrecedence(t *testing.T) {
+	var (
+		f      = ConstraintFilter{}
+		nodes  = testFixtures()[:2]
+		result []*node.Node
+		err    error
+	)
+
+	// node-0 runs no container and has the rexray plugin, but labels
+	// named after the swarm keys take precedence.
+	nodes[0].Plugins = types.PluginsInfo{Volume: []string{"rexray"}}
+	nodes[0].Labels["containers"] = "many"
+	nodes[0].Labels["volumedriver"] = "local"
+	nodes[0].Labels["node"] = "rack-1"
+
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:containers==many"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.NoError(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, result[0], nodes[0])
+
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:containers<1"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.NoError(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, result[0], nodes[1])
+
+	_, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:volumedriver==rexray"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.Error(t, err)
+
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:node==rack-1"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.NoError(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, result[0], nodes[0])
+
+	// the other keys are still computed
+	result, err = f.Filter(cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:freemem>=0"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{}), nodes, true)
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+}
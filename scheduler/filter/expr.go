@@ -1,10 +1,14 @@
 package filter
 
 import (
+	"bytes"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 
+	"github.com/docker/go-units"
+	"github.com/docker/swarm/scheduler/node"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -13,16 +17,38 @@ const (
 	EQ = iota
 	// NOTEQ is exported
 	NOTEQ
+	// LTE is exported
+	LTE
+	// GTE is exported
+	GTE
+	// LT is exported
+	LT
+	// GT is exported
+	GT
 )
 
 // OPERATORS is exported
-var OPERATORS = []string{"==", "!="}
+// <= and >= must come before < and > as operators are searched in order.
+var OPERATORS = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// ignoreCaseRegexp matches a non-empty regexp value followed by the i
+// modifier. A / within the pattern has to be escaped, so that a path such as
+// /usr/lib/i isn't mistaken for one.
+var ignoreCaseRegexp = regexp.MustCompile(`^/(?:[^/\\]|\\.)+/i$`)
 
 type expr struct {
-	key      string
-	operator int
-	value    string
-	isSoft   bool
+	key        string
+	operator   int
+	value      string
+	isSoft     bool
+	ignoreCase bool
+}
+
+// FilterRejection describes why a node was rejected by an expression.
+type FilterRejection struct {
+	Node   *node.Node
+	Expr   string
+	Reason string
 }
 
 func parseExprs(env []string) ([]expr, error) {
@@ -35,29 +61,60 @@ func parseExprs(env []string) ([]expr, error) {
 				parts := strings.SplitN(e, op, 2)
 
 				// validate key
-				// allow alpha-numeric
-				matched, err := regexp.MatchString(`^(?i)[a-z_][a-z0-9\-_.]+$`, parts[0])
-				if err != nil {
-					return nil, err
-				}
-				if matched == false {
-					return nil, fmt.Errorf("Key '%s' is invalid", parts[0])
+				// allow alpha-numeric, and dots for namespaced labels
+				// as long as they don't end the key
+				// allow several keys separated by |
+				for _, key := range strings.Split(parts[0], "|") {
+					matched, err := regexp.MatchString(`^(?i)[a-z_][a-z0-9\-_.]*[a-z0-9\-_]$`, key)
+					if err != nil {
+						return nil, err
+					}
+					if matched == false {
+						return nil, fmt.Errorf("Key '%s' is invalid", parts[0])
+					}
 				}
 
-				if len(parts) == 2 {
+				if len(parts) == 2 && i > NOTEQ {
+					// numeric comparison
+					e := expr{key: parts[0], operator: i, value: strings.TrimLeft(parts[1], "~"), isSoft: isSoft(parts[1])}
+					if _, err := parseNumber(e.value); err != nil {
+						return nil, fmt.Errorf("Value '%s' is invalid: a number is expected with %s", parts[1], op)
+					}
+					exprs = append(exprs, e)
+				} else if len(parts) == 2 && strings.TrimLeft(parts[1], "~") == "" {
+					// no value: only check whether the key is set
+					exprs = append(exprs, expr{key: parts[0], operator: i, isSoft: isSoft(parts[1])})
+				} else if len(parts) == 2 {
 
 					// validate value
 					// allow leading = in case of using ==
 					// allow * for globbing
 					// allow regexp
-					matched, err := regexp.MatchString(`^(?i)[=!\/]?(~)?[a-z0-9:\-_\s\.\*/\(\)\?\+\[\]\\\^\$\|]+$`, parts[1])
+					// allow @ for image digests
+					matched, err := regexp.MatchString(`^(?i)[=!\/]?(~)?[a-z0-9:@\-_\s\.\*/\(\)\?\+\[\]\\\^\$\|]+$`, parts[1])
 					if err != nil {
 						return nil, err
 					}
 					if matched == false {
 						return nil, fmt.Errorf("Value '%s' is invalid", parts[1])
 					}
-					exprs = append(exprs, expr{key: parts[0], operator: i, value: strings.TrimLeft(parts[1], "~"), isSoft: isSoft(parts[1])})
+					e := expr{key: parts[0], operator: i, value: strings.TrimLeft(parts[1], "~"), isSoft: isSoft(parts[1])}
+					// a trailing i after a regexp makes the match
+					// case-insensitive (ex. /us-.*/i). Other values ending
+					// in /i, such as paths, are matched as they are.
+					if e.value == "/i" || e.value == "//i" {
+						return nil, fmt.Errorf("Value '%s' is invalid: /i only applies to a regexp, as in /pattern/i", parts[1])
+					}
+					if ignoreCaseRegexp.MatchString(e.value) {
+						e.value = strings.TrimSuffix(e.value, "i")
+						e.ignoreCase = true
+					}
+					// make sure the value compiles, so that a bad regexp is
+					// reported to the user instead of never matching.
+					if _, err := e.compile(); err != nil {
+						return nil, fmt.Errorf("Value '%s' is invalid: %v", parts[1], err)
+					}
+					exprs = append(exprs, e)
 				} else {
 					exprs = append(exprs, expr{key: parts[0], operator: i})
 				}
@@ -67,28 +124,83 @@ func parseExprs(env []string) ([]expr, error) {
 			}
 		}
 		if !found {
-			return nil, fmt.Errorf("One of operator ==, != is expected")
+			return nil, fmt.Errorf("One of operator %s is expected", strings.Join(OPERATORS, ", "))
 		}
 	}
 	return exprs, nil
 }
 
+// filterExprs returns the nodes matching all the expressions, along with the
+// reason each of the other nodes was rejected. values returns what an
+// expression is matched against on a node.
+func filterExprs(exprs []expr, nodes []*node.Node, values func(expr, *node.Node) []string) ([]*node.Node, []FilterRejection) {
+	candidates := []*node.Node{}
+	rejections := []FilterRejection{}
+	for _, n := range nodes {
+		rejected := false
+		for _, e := range exprs {
+			whats := values(e, n)
+			if !e.Match(whats...) {
+				rejections = append(rejections, FilterRejection{Node: n, Expr: e.String(), Reason: e.reason(whats...)})
+				rejected = true
+				break
+			}
+		}
+		if !rejected {
+			candidates = append(candidates, n)
+		}
+	}
+	return candidates, rejections
+}
+
+// String returns the expression as written by the user, without the soft
+// marker.
+func (e *expr) String() string {
+	return fmt.Sprintf("%s%s%s", e.key, OPERATORS[e.operator], e.value)
+}
+
+// reason explains why whats don't match the expression.
+func (e *expr) reason(whats ...string) string {
+	values := []string{}
+	for _, what := range whats {
+		if what != "" {
+			values = append(values, fmt.Sprintf("%q", what))
+		}
+	}
+	if len(values) == 0 {
+		return fmt.Sprintf("%s is not set", e.key)
+	}
+	got := strings.Join(values, ", ")
+
+	switch {
+	case e.value == "":
+		return fmt.Sprintf("%s is set to %s", e.key, got)
+	case e.operator == EQ:
+		return fmt.Sprintf("%s is %s, which doesn't match %s", e.key, got, e.value)
+	case e.operator > NOTEQ:
+		return fmt.Sprintf("%s is %s, which isn't %s %s", e.key, got, OPERATORS[e.operator], e.value)
+	default:
+		return fmt.Sprintf("%s is %s, which matches %s", e.key, got, e.value)
+	}
+}
+
+// Match returns true if one of whats matches the expression. An expression
+// without a value checks for existence: `key==` matches when one of whats is
+// non-empty, `key!=` when all of them are empty.
 func (e *expr) Match(whats ...string) bool {
-	var (
-		pattern string
-		match   bool
-	)
+	var match bool
 
-	if e.value[0] == '/' && e.value[len(e.value)-1] == '/' {
-		// regexp
-		pattern = e.value[1 : len(e.value)-1]
-	} else {
-		// simple match, create the regex for globbing (ex: ub*t* -> ^ub.*t.*$) and match.
-		pattern = "^" + strings.Replace(e.value, "*", ".*", -1) + "$"
+	if e.operator > NOTEQ {
+		return e.compare(whats...)
 	}
 
-	re, err := regexp.Compile(pattern)
-	if err == nil {
+	if e.value == "" {
+		for _, what := range whats {
+			if match = what != ""; match {
+				break
+			}
+		}
+	} else if re, err := e.compile(); err == nil {
 		for _, what := range whats {
 			if match = re.MatchString(what); match {
 				break
@@ -109,8 +221,89 @@ func (e *expr) Match(whats ...string) bool {
 	return false
 }
 
+// compare returns true if one of whats is a number satisfying the numeric
+// comparison of the expression.
+func (e *expr) compare(whats ...string) bool {
+	value, err := parseNumber(e.value)
+	if err != nil {
+		log.Error(err)
+		return false
+	}
+	for _, what := range whats {
+		n, err := strconv.ParseFloat(what, 64)
+		if err != nil {
+			continue
+		}
+		switch {
+		case e.operator == LTE && n <= value,
+			e.operator == GTE && n >= value,
+			e.operator == LT && n < value,
+			e.operator == GT && n > value:
+			return true
+		}
+	}
+	return false
+}
+
+// parseNumber parses a number which may also be a human-readable size
+// (ex. 512m or 2g).
+func parseNumber(value string) (float64, error) {
+	n, err := strconv.ParseFloat(value, 64)
+	if err == nil {
+		return n, nil
+	}
+	size, err := units.RAMInBytes(value)
+	if err != nil {
+		return 0, err
+	}
+	return float64(size), nil
+}
+
+// keys returns the keys of the expression, several keys being separated by |.
+func (e *expr) keys() []string {
+	return strings.Split(e.key, "|")
+}
+
+// compile returns the regular expression matching the value of the expression.
+func (e *expr) compile() (*regexp.Regexp, error) {
+	flags := ""
+	if e.ignoreCase {
+		flags = "(?i)"
+	}
+	if len(e.value) > 1 && e.value[0] == '/' && e.value[len(e.value)-1] == '/' {
+		// regexp
+		return regexp.Compile(flags + e.value[1:len(e.value)-1])
+	}
+	// simple match, create the regex for globbing (ex: ub*t* -> ^ub.*t.*$) and match.
+	// Alternatives are separated by | (ex: a|b* -> ^(?:a|b.*)$).
+	alternatives := strings.Split(e.value, "|")
+	for i, alternative := range alternatives {
+		alternatives[i] = globToRegexp(alternative)
+	}
+	return regexp.Compile(flags + "^(?:" + strings.Join(alternatives, "|") + ")$")
+}
+
+// globToRegexp converts a globbing pattern into a regular expression. `*`
+// matches any sequence of characters and `?` a single character, every other
+// character is matched literally, so that a value such as 1.2.3 doesn't match
+// 1X2X3.
+func globToRegexp(glob string) string {
+	var re bytes.Buffer
+	for _, r := range glob {
+		switch r {
+		case '*':
+			re.WriteString(".*")
+		case '?':
+			re.WriteString(".")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	return re.String()
+}
+
 func isSoft(value string) bool {
-	if value[0] == '~' {
+	if strings.HasPrefix(value, "~") {
 		return true
 	}
 	return false
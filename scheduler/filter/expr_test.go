@@ -34,6 +34,26 @@ func TestParseExprs(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, exprs[0].key, "no.de")
 	assert.Equal(t, exprs[0].value, "node1")
+	exprs, err = parseExprs([]string{"com.example.zone==foo"})
+	assert.NoError(t, err)
+	assert.Equal(t, exprs[0].key, "com.example.zone")
+	assert.Equal(t, exprs[0].value, "foo")
+
+	// Allow several keys separated by |
+	exprs, err = parseExprs([]string{"gpu|fpga==true"})
+	assert.NoError(t, err)
+	assert.Equal(t, exprs[0].key, "gpu|fpga")
+	assert.Equal(t, exprs[0].keys(), []string{"gpu", "fpga"})
+	_, err = parseExprs([]string{"gpu|==true"})
+	assert.Error(t, err)
+	_, err = parseExprs([]string{"|fpga==true"})
+	assert.Error(t, err)
+
+	// Cannot use a leading or trailing dot in key
+	_, err = parseExprs([]string{".bad==foo"})
+	assert.Error(t, err)
+	_, err = parseExprs([]string{"bad.==foo"})
+	assert.Error(t, err)
 
 	// Allow leading underscore
 	exprs, err = parseExprs([]string{"_node==_node1"})
@@ -59,8 +79,72 @@ func TestParseExprs(t *testing.T) {
 	assert.Equal(t, exprs[0].key, "node")
 	assert.Equal(t, exprs[0].value, "node 1")
 
-	// Doesn't allow empty value
-	_, err = parseExprs([]string{"node=="})
+	// Allow empty value, to check whether the key is set
+	exprs, err = parseExprs([]string{"gpu=="})
+	assert.NoError(t, err)
+	assert.Equal(t, exprs[0].key, "gpu")
+	assert.Equal(t, exprs[0].operator, EQ)
+	assert.Equal(t, exprs[0].value, "")
+	exprs, err = parseExprs([]string{"gpu!=~"})
+	assert.NoError(t, err)
+	assert.Equal(t, exprs[0].operator, NOTEQ)
+	assert.Equal(t, exprs[0].value, "")
+	assert.True(t, exprs[0].isSoft)
+
+	// Allow a trailing i after a regexp for case-insensitive matches
+	exprs, err = parseExprs([]string{"zone==/us-.*/i"})
+	assert.NoError(t, err)
+	assert.Equal(t, exprs[0].value, "/us-.*/")
+	assert.True(t, exprs[0].ignoreCase)
+	exprs, err = parseExprs([]string{`path==/usr\/lib/i`})
+	assert.NoError(t, err)
+	assert.Equal(t, exprs[0].value, `/usr\/lib/`)
+	assert.True(t, exprs[0].ignoreCase)
+	exprs, err = parseExprs([]string{"zone==us-east"})
+	assert.NoError(t, err)
+	assert.False(t, exprs[0].ignoreCase)
+
+	// Other values ending in /i are kept as they are
+	for _, value := range []string{"US-East/i", "/usr/lib/i", "foo/i"} {
+		exprs, err = parseExprs([]string{"path==" + value})
+		assert.NoError(t, err)
+		assert.Equal(t, exprs[0].value, value)
+		assert.False(t, exprs[0].ignoreCase)
+	}
+
+	// /i needs a regexp
+	_, err = parseExprs([]string{"zone==/i"})
+	assert.Error(t, err)
+	_, err = parseExprs([]string{"zone==~/i"})
+	assert.Error(t, err)
+	_, err = parseExprs([]string{"zone==//i"})
+	assert.Error(t, err)
+
+	// Allow numeric comparisons
+	for op, operator := range map[string]int{"<": LT, "<=": LTE, ">": GT, ">=": GTE} {
+		exprs, err = parseExprs([]string{"containers" + op + "5"})
+		assert.NoError(t, err)
+		assert.Equal(t, exprs[0].key, "containers")
+		assert.Equal(t, exprs[0].operator, operator)
+		assert.Equal(t, exprs[0].value, "5")
+	}
+	exprs, err = parseExprs([]string{"load<~0.5"})
+	assert.NoError(t, err)
+	assert.Equal(t, exprs[0].value, "0.5")
+	assert.True(t, exprs[0].isSoft)
+
+	// Numeric comparisons need a number
+	_, err = parseExprs([]string{"containers<five"})
+	assert.Error(t, err)
+	_, err = parseExprs([]string{"freemem>512m"})
+	assert.NoError(t, err)
+	_, err = parseExprs([]string{"containers>="})
+	assert.Error(t, err)
+
+	// Doesn't allow an invalid regexp
+	_, err = parseExprs([]string{"node==/node[/"})
+	assert.Error(t, err)
+	_, err = parseExprs([]string{"node!=~/(node/"})
 	assert.Error(t, err)
 }
 
@@ -85,4 +169,145 @@ func TestMatch(t *testing.T) {
 	assert.False(t, e.Match("foo"))
 	assert.False(t, e.Match("fuo"))
 	assert.False(t, e.Match("foo", "fuo", "bar"))
+
+	e = expr{operator: EQ, value: "us-*"}
+	assert.True(t, e.Match("us-east"))
+	assert.True(t, e.Match("us-west"))
+	assert.False(t, e.Match("eu-west"))
+
+	e = expr{operator: EQ, value: "node-?"}
+	assert.True(t, e.Match("node-1"))
+	assert.True(t, e.Match("node-2"))
+	assert.False(t, e.Match("node-"))
+	assert.False(t, e.Match("node-10"))
+
+	e = expr{operator: NOTEQ, value: "node-?"}
+	assert.False(t, e.Match("node-1"))
+	assert.True(t, e.Match("node-10"))
+
+	// Only * and ? are special in globbing patterns.
+	e = expr{operator: EQ, value: "1.2.3"}
+	assert.True(t, e.Match("1.2.3"))
+	assert.False(t, e.Match("1X2X3"))
+
+	e = expr{operator: EQ, value: "1.2.*"}
+	assert.True(t, e.Match("1.2.3"))
+	assert.True(t, e.Match("1.2.10"))
+	assert.False(t, e.Match("1X2X3"))
+
+	e = expr{operator: EQ, value: "a+b"}
+	assert.True(t, e.Match("a+b"))
+	assert.False(t, e.Match("aab"))
+
+	// Regular expressions keep their own semantics.
+	e = expr{operator: EQ, value: "/1.2.3/"}
+	assert.True(t, e.Match("1X2X3"))
+
+	// Alternatives are separated by |.
+	e = expr{operator: EQ, value: "us-east|us-west"}
+	assert.True(t, e.Match("us-east"))
+	assert.True(t, e.Match("us-west"))
+	assert.False(t, e.Match("eu"))
+	assert.False(t, e.Match("us-east|us-west"))
+	assert.True(t, e.Match("eu", "us-west"))
+
+	e = expr{operator: EQ, value: "eu|us-*"}
+	assert.True(t, e.Match("eu"))
+	assert.True(t, e.Match("us-east"))
+	assert.False(t, e.Match("eu-west"))
+
+	e = expr{operator: NOTEQ, value: "us-east|us-west"}
+	assert.False(t, e.Match("us-east"))
+	assert.False(t, e.Match("us-west"))
+	assert.True(t, e.Match("eu"))
+	assert.False(t, e.Match("eu", "us-west"))
+
+	// Case-insensitive matches.
+	e = expr{operator: EQ, value: "US-East", ignoreCase: true}
+	assert.True(t, e.Match("us-east"))
+	assert.True(t, e.Match("US-EAST"))
+	assert.False(t, e.Match("us-west"))
+
+	e = expr{operator: NOTEQ, value: "us-*", ignoreCase: true}
+	assert.False(t, e.Match("US-East"))
+	assert.True(t, e.Match("EU-West"))
+
+	e = expr{operator: EQ, value: "/^us-/", ignoreCase: true}
+	assert.True(t, e.Match("US-East"))
+
+	e = expr{operator: EQ, value: "US-East"}
+	assert.False(t, e.Match("us-east"))
+
+	// Numeric comparisons.
+	e = expr{operator: LT, value: "5"}
+	assert.True(t, e.Match("4"))
+	assert.False(t, e.Match("5"))
+	assert.True(t, e.Match("10", "4.5"))
+	assert.False(t, e.Match("foo"))
+	assert.False(t, e.Match(""))
+
+	e = expr{operator: LTE, value: "5"}
+	assert.True(t, e.Match("5"))
+	assert.False(t, e.Match("6"))
+
+	e = expr{operator: GT, value: "0.5"}
+	assert.True(t, e.Match("1"))
+	assert.False(t, e.Match("0.5"))
+
+	e = expr{operator: GTE, value: "0.5"}
+	assert.True(t, e.Match("0.5"))
+	assert.False(t, e.Match("0.25"))
+
+	// Numeric values can be human-readable sizes.
+	e = expr{operator: GT, value: "2g"}
+	assert.True(t, e.Match("3221225472"))
+	assert.False(t, e.Match("2147483648"))
+
+	// An empty value checks for existence.
+	e = expr{operator: EQ, value: ""}
+	assert.True(t, e.Match("foo"))
+	assert.True(t, e.Match("", "foo"))
+	assert.False(t, e.Match(""))
+	assert.False(t, e.Match())
+
+	e = expr{operator: NOTEQ, value: ""}
+	assert.False(t, e.Match("foo"))
+	assert.False(t, e.Match("", "foo"))
+	assert.True(t, e.Match(""))
+	assert.True(t, e.Match())
+}
+
+func TestFilterExprs(t *testing.T) {
+	nodes := testFixtures()
+	exprs, err := parseExprs([]string{"region==us-*", "group!=1", "name==node*"})
+	assert.NoError(t, err)
+
+	candidates, rejections := filterExprs(exprs, nodes, constraintValues)
+	assert.Empty(t, candidates)
+	assert.Len(t, rejections, 4)
+
+	// Each node is rejected by the first expression it fails.
+	assert.Equal(t, rejections[0].Node, nodes[0])
+	assert.Equal(t, rejections[0].Expr, "group!=1")
+	assert.Equal(t, rejections[0].Reason, `group is "1", which matches 1`)
+	assert.Equal(t, rejections[1].Node, nodes[1])
+	assert.Equal(t, rejections[1].Expr, "group!=1")
+	assert.Equal(t, rejections[2].Node, nodes[2])
+	assert.Equal(t, rejections[2].Expr, "region==us-*")
+	assert.Equal(t, rejections[2].Reason, `region is "eu", which doesn't match us-*`)
+	assert.Equal(t, rejections[3].Node, nodes[3])
+	assert.Equal(t, rejections[3].Expr, "region==us-*")
+	assert.Equal(t, rejections[3].Reason, "region is not set")
+
+	exprs, err = parseExprs([]string{"group==1", "gpu!="})
+	assert.NoError(t, err)
+	nodes[1].Labels["gpu"] = "nvidia"
+
+	candidates, rejections = filterExprs(exprs, nodes, constraintValues)
+	assert.Len(t, candidates, 1)
+	assert.Equal(t, candidates[0], nodes[0])
+	assert.Len(t, rejections, 3)
+	assert.Equal(t, rejections[0].Node, nodes[1])
+	assert.Equal(t, rejections[0].Expr, "gpu!=")
+	assert.Equal(t, rejections[0].Reason, `gpu is set to "nvidia"`)
 }
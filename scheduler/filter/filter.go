@@ -61,24 +61,94 @@ func New(names []string) ([]Filter, error) {
 
 // ApplyFilters applies a set of filters in batch.
 func ApplyFilters(filters []Filter, config *cluster.ContainerConfig, nodes []*node.Node, soft bool) ([]*node.Node, error) {
-	var (
-		err        error
-		candidates = nodes
-	)
+	candidates := nodes
+	// stages holds the nodes given to each filter, to tell which one
+	// dropped a node if no node is left.
+	stages := [][]*node.Node{}
 
 	for _, filter := range filters {
-		candidates, err = filter.Filter(config, candidates, soft)
+		stages = append(stages, candidates)
+		filtered, err := filter.Filter(config, candidates, soft)
 		if err != nil {
 			// special case for when no healthy nodes are found
 			if filter.Name() == "health" {
 				return nil, err
 			}
-			return nil, fmt.Errorf("Unable to find a node that satisfies the following conditions %s", listAllFilters(filters, config, filter.Name()))
+			return nil, newErrNoSuitableNode(filters, config, nodes, stages, filter.Name(), soft)
 		}
+		candidates = filtered
 	}
 	return candidates, nil
 }
 
+// ErrNoSuitableNode is returned by ApplyFilters when no node satisfies the
+// filters of a container.
+type ErrNoSuitableNode struct {
+	// Conditions lists the filters applied, up to the one which failed.
+	Conditions string
+	// Constraints are the constraints of the container.
+	Constraints []string
+	// Rejections tells why each node of the cluster was rejected: by the
+	// constraint it fails or, for a node dropped before the constraints
+	// were checked, by the filter which dropped it. It is only set when the
+	// constraint filter failed.
+	Rejections []FilterRejection
+}
+
+func (e *ErrNoSuitableNode) Error() string {
+	return fmt.Sprintf("Unable to find a node that satisfies the following conditions %s", e.Conditions)
+}
+
+// newErrNoSuitableNode returns the error for lastFilter failing. stages holds
+// the nodes given to each filter applied, up to lastFilter.
+func newErrNoSuitableNode(filters []Filter, config *cluster.ContainerConfig, nodes []*node.Node, stages [][]*node.Node, lastFilter string, soft bool) *ErrNoSuitableNode {
+	err := &ErrNoSuitableNode{
+		Conditions:  listAllFilters(filters, config, lastFilter),
+		Constraints: config.Constraints(),
+	}
+	// The rejections of the constraints don't explain why another filter
+	// failed.
+	if lastFilter != "constraint" {
+		return err
+	}
+	constraints, parseErr := parseExprs(err.Constraints)
+	if parseErr != nil {
+		return err
+	}
+	applied := []expr{}
+	for _, constraint := range constraints {
+		if soft || !constraint.isSoft {
+			applied = append(applied, constraint)
+		}
+	}
+
+	rejections := make(map[*node.Node]FilterRejection)
+	// a node missing from the next stage was dropped by the filter
+	for i := 0; i < len(stages)-1; i++ {
+		kept := make(map[*node.Node]bool)
+		for _, n := range stages[i+1] {
+			kept[n] = true
+		}
+		for _, n := range stages[i] {
+			if !kept[n] {
+				rejections[n] = FilterRejection{Node: n, Reason: fmt.Sprintf("rejected by the %s filter", filters[i].Name())}
+			}
+		}
+	}
+	_, constraintRejections := filterExprs(applied, stages[len(stages)-1], constraintValues)
+	for _, rejection := range constraintRejections {
+		rejections[rejection.Node] = rejection
+	}
+
+	err.Rejections = []FilterRejection{}
+	for _, n := range nodes {
+		if rejection, ok := rejections[n]; ok {
+			err.Rejections = append(err.Rejections, rejection)
+		}
+	}
+	return err
+}
+
 // listAllFilters creates a string containing all applied filters.
 func listAllFilters(filters []Filter, config *cluster.ContainerConfig, lastFilter string) string {
 	allFilters := ""
@@ -77,3 +77,78 @@ func TestApplyFilters(t *testing.T) {
 	assert.Len(t, result, 1)
 
 }
+
+func TestApplyFiltersNoSuitableNode(t *testing.T) {
+	nodes := testFixtures()
+	config := cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:region==us-*", "constraint:group==2"}}, containertypes.HostConfig{}, networktypes.NetworkingConfig{})
+
+	result, err := ApplyFilters([]Filter{&ConstraintFilter{}}, config, nodes, true)
+	assert.Len(t, result, 0)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Unable to find a node that satisfies the following conditions")
+
+	noNode, ok := err.(*ErrNoSuitableNode)
+	assert.True(t, ok)
+	assert.Equal(t, noNode.Constraints, []string{"region==us-*", "group==2"})
+
+	// Every node is listed, with the first constraint it fails.
+	assert.Len(t, noNode.Rejections, 4)
+	assert.Equal(t, noNode.Rejections[0].Node, nodes[0])
+	assert.Equal(t, noNode.Rejections[0].Expr, "group==2")
+	assert.Equal(t, noNode.Rejections[0].Reason, `group is "1", which doesn't match 2`)
+	assert.Equal(t, noNode.Rejections[1].Node, nodes[1])
+	assert.Equal(t, noNode.Rejections[1].Expr, "group==2")
+	assert.Equal(t, noNode.Rejections[2].Node, nodes[2])
+	assert.Equal(t, noNode.Rejections[2].Expr, "region==us-*")
+	assert.Equal(t, noNode.Rejections[2].Reason, `region is "eu", which doesn't match us-*`)
+	assert.Equal(t, noNode.Rejections[3].Node, nodes[3])
+	assert.Equal(t, noNode.Rejections[3].Reason, "region is not set")
+}
+
+func TestApplyFiltersNoSuitableNodePorts(t *testing.T) {
+	nodes := testFixtures()
+	config := cluster.BuildContainerConfig(containertypes.Config{Env: []string{"constraint:region==us-*"}}, containertypes.HostConfig{
+		PortBindings: makeBinding("", "80"),
+	}, networktypes.NetworkingConfig{})
+	filters := []Filter{&PortFilter{}, &ConstraintFilter{}}
+
+	// node-0 and node-1 match the constraint, but node-0 already uses the
+	// port.
+	container := &cluster.Container{Container: types.Container{ID: "c1"}, Info: types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			HostConfig: &containertypes.HostConfig{
+				PortBindings: makeBinding("", "80"),
+			},
+		},
+	}}
+	assert.NoError(t, nodes[0].AddContainer(container))
+	result, err := ApplyFilters(filters, config, nodes, true)
+	assert.NoError(t, err)
+	assert.Equal(t, result, []*node.Node{nodes[1]})
+
+	// The constraint fails on the nodes left by the port filter, the other
+	// nodes are listed with the filter which dropped them.
+	assert.NoError(t, nodes[1].AddContainer(container))
+	_, err = ApplyFilters(filters, config, nodes, true)
+	noNode, ok := err.(*ErrNoSuitableNode)
+	assert.True(t, ok)
+	assert.Len(t, noNode.Rejections, 4)
+	assert.Equal(t, noNode.Rejections[0].Node, nodes[0])
+	assert.Equal(t, noNode.Rejections[0].Expr, "")
+	assert.Equal(t, noNode.Rejections[0].Reason, "rejected by the port filter")
+	assert.Equal(t, noNode.Rejections[1].Node, nodes[1])
+	assert.Equal(t, noNode.Rejections[1].Reason, "rejected by the port filter")
+	assert.Equal(t, noNode.Rejections[2].Node, nodes[2])
+	assert.Equal(t, noNode.Rejections[2].Expr, "region==us-*")
+	assert.Equal(t, noNode.Rejections[3].Node, nodes[3])
+	assert.Equal(t, noNode.Rejections[3].Reason, "region is not set")
+
+	// The port filter fails, the constraints didn't reject any node.
+	assert.NoError(t, nodes[2].AddContainer(container))
+	assert.NoError(t, nodes[3].AddContainer(container))
+	_, err = ApplyFilters(filters, config, nodes, true)
+	noNode, ok = err.(*ErrNoSuitableNode)
+	assert.True(t, ok)
+	assert.Equal(t, noNode.Constraints, []string{"region==us-*"})
+	assert.Empty(t, noNode.Rejections)
+}
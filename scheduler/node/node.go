@@ -3,6 +3,7 @@ package node
 import (
 	"errors"
 
+	"github.com/docker/docker/api/types"
 	"github.com/docker/swarm/cluster"
 )
 
@@ -13,6 +14,7 @@ type Node struct {
 	Addr       string
 	Name       string
 	Labels     map[string]string
+	Plugins    types.PluginsInfo
 	Containers cluster.Containers
 	Images     []*cluster.Image
 
@@ -22,6 +24,8 @@ type Node struct {
 	TotalCpus   int64
 
 	HealthIndicator int64
+	Cordoned        bool
+	RescheduleLoad  int64
 }
 
 // NewNode creates a node from an engine.
@@ -32,6 +36,7 @@ func NewNode(e *cluster.Engine) *Node {
 		Addr:            e.Addr,
 		Name:            e.Name,
 		Labels:          e.Labels,
+		Plugins:         e.Plugins,
 		Containers:      e.Containers(),
 		Images:          e.Images(),
 		UsedMemory:      e.UsedMemory(),
@@ -39,6 +44,8 @@ func NewNode(e *cluster.Engine) *Node {
 		TotalMemory:     e.TotalMemory(),
 		TotalCpus:       e.TotalCpus(),
 		HealthIndicator: e.HealthIndicator(),
+		Cordoned:        e.IsCordoned(),
+		RescheduleLoad:  e.RescheduleLoad(),
 	}
 }
 
@@ -55,8 +62,8 @@ func (n *Node) Container(IDOrName string) *cluster.Container {
 // AddContainer injects a container into the internal state.
 func (n *Node) AddContainer(container *cluster.Container) error {
 	if container.Config != nil {
-		memory := container.Config.HostConfig.Memory
-		cpus := container.Config.HostConfig.CPUShares
+		memory := container.Config.RequestedMemory()
+		cpus := container.Config.RequestedCPUShares()
 		if n.TotalMemory-memory < 0 || n.TotalCpus-cpus < 0 {
 			return errors.New("not enough resources")
 		}
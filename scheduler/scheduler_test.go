@@ -3,6 +3,7 @@ package scheduler
 import (
 	"testing"
 
+	"github.com/docker/docker/api/types"
 	containertypes "github.com/docker/docker/api/types/container"
 	networktypes "github.com/docker/docker/api/types/network"
 	"github.com/docker/swarm/cluster"
@@ -116,3 +117,60 @@ func TestSelectNodesForContainerHybrid(t *testing.T) {
 	assert.Equal(t, 1, len(candidates))
 	assert.Equal(t, "node-0-id", candidates[0].ID)
 }
+
+func TestSelectNodesForContainerSoftAntiAffinity(t *testing.T) {
+	var (
+		s = Scheduler{
+			strategy: &strategy.SpreadPlacementStrategy{},
+			filters:  []filter.Filter{&filter.AffinityFilter{}},
+		}
+
+		nginx = func(node string) *cluster.Image {
+			return &cluster.Image{ImageSummary: types.ImageSummary{
+				ID:       node + "-nginx-id",
+				RepoTags: []string{"nginx:latest"},
+			}}
+		}
+
+		nodes = []*node.Node{
+			{
+				ID:          "node-0-id",
+				Name:        "node-0-name",
+				Addr:        "node-0",
+				TotalMemory: 1 * 1024 * 1024 * 1024,
+				TotalCpus:   1,
+				Images:      []*cluster.Image{nginx("node-0")},
+			},
+			{
+				ID:          "node-1-id",
+				Name:        "node-1-name",
+				Addr:        "node-1",
+				TotalMemory: 1 * 1024 * 1024 * 1024,
+				TotalCpus:   1,
+			},
+		}
+
+		config = cluster.BuildContainerConfig(containertypes.Config{
+			Env: []string{"affinity:image!=~nginx"},
+		}, containertypes.HostConfig{}, networktypes.NetworkingConfig{})
+	)
+
+	// The node without nginx is preferred.
+	candidates, err := s.SelectNodesForContainer(nodes, config)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(candidates))
+	assert.Equal(t, "node-1-id", candidates[0].ID)
+
+	// Once every node has nginx, the soft anti-affinity is ignored.
+	nodes[1].Images = []*cluster.Image{nginx("node-1")}
+	candidates, err = s.SelectNodesForContainer(nodes, config)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(candidates))
+
+	// A hard anti-affinity fails instead.
+	config = cluster.BuildContainerConfig(containertypes.Config{
+		Env: []string{"affinity:image!=nginx"},
+	}, containertypes.HostConfig{}, networktypes.NetworkingConfig{})
+	_, err = s.SelectNodesForContainer(nodes, config)
+	assert.Error(t, err)
+}
@@ -107,6 +107,24 @@ func TestPlaceContainerMemory(t *testing.T) {
 	assert.Equal(t, len(node1.Containers), len(node2.Containers))
 }
 
+func TestPlaceContainerRequestedMemory(t *testing.T) {
+	s := &BinpackPlacementStrategy{}
+
+	// node-0 has 1G free once its 1G container is added
+	nodes := []*node.Node{createNode("node-0", 2, 0)}
+	assert.NoError(t, nodes[0].AddContainer(createContainer("c1", createConfig(1, 0))))
+
+	// a 2G request can't fit
+	config := createConfig(2, 0)
+	assert.Equal(t, int64(2*1024*1024*1024), config.RequestedMemory())
+	_, err := s.RankAndSort(config, nodes)
+	assert.Error(t, err)
+
+	// it goes to a node with enough free memory
+	nodes = append(nodes, createNode("node-1", 4, 0))
+	assert.Equal(t, "node-1", selectTopNode(t, s, config, nodes).ID)
+}
+
 func TestPlaceContainerCPU(t *testing.T) {
 	s := &BinpackPlacementStrategy{}
 
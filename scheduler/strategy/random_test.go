@@ -0,0 +1,69 @@
+package strategy
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/docker/swarm/scheduler/node"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewStrategy(t *testing.T) {
+	for _, name := range List() {
+		s, err := New(name)
+		assert.NoError(t, err)
+		assert.Equal(t, s.Name(), name)
+	}
+
+	// "binpacking" is kept as an alias of "binpack" for compatibility.
+	s, err := New("binpacking")
+	assert.NoError(t, err)
+	assert.Equal(t, s.Name(), "binpack")
+
+	_, err = New("unknown")
+	assert.Equal(t, err, ErrNotSupported)
+}
+
+func TestRandomPlaceKeepsAllNodes(t *testing.T) {
+	s, err := New("random")
+	assert.NoError(t, err)
+
+	nodes := []*node.Node{}
+	for i := 0; i < 10; i++ {
+		nodes = append(nodes, createNode(fmt.Sprintf("node-%d", i), 2, 1))
+	}
+
+	// Put some load on a few nodes: random placement should ignore it.
+	config := createConfig(1, 0)
+	assert.NoError(t, nodes[0].AddContainer(createContainer("c0", config)))
+	assert.NoError(t, nodes[1].AddContainer(createContainer("c1", config)))
+
+	ranked, err := s.RankAndSort(createConfig(0, 0), nodes)
+	assert.NoError(t, err)
+	assert.Len(t, ranked, 10)
+
+	seen := map[string]bool{}
+	for _, n := range ranked {
+		seen[n.ID] = true
+	}
+	assert.Len(t, seen, 10)
+}
+
+func TestRandomPlaceDistribution(t *testing.T) {
+	s, err := New("random")
+	assert.NoError(t, err)
+
+	nodes := []*node.Node{
+		createNode("node-0", 2, 1),
+		createNode("node-1", 2, 1),
+	}
+
+	// Over enough runs, both nodes should be picked at least once.
+	picked := map[string]int{}
+	for i := 0; i < 100; i++ {
+		n := selectTopNode(t, s, createConfig(0, 0), nodes)
+		picked[n.ID]++
+	}
+	assert.NotZero(t, picked["node-0"])
+	assert.NotZero(t, picked["node-1"])
+}
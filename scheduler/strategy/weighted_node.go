@@ -39,12 +39,15 @@ func (n weightedNodeList) Less(i, j int) bool {
 func weighNodes(config *cluster.ContainerConfig, nodes []*node.Node, healthinessFactor int64) (weightedNodeList, error) {
 	weightedNodes := weightedNodeList{}
 
+	memory := config.RequestedMemory()
+	cpus := config.RequestedCPUShares()
+
 	for _, node := range nodes {
 		nodeMemory := node.TotalMemory
 		nodeCpus := node.TotalCpus
 
 		// Skip nodes that are smaller than the requested resources.
-		if nodeMemory < int64(config.HostConfig.Memory) || nodeCpus < config.HostConfig.CPUShares {
+		if nodeMemory < memory || nodeCpus < cpus {
 			continue
 		}
 
@@ -53,11 +56,11 @@ func weighNodes(config *cluster.ContainerConfig, nodes []*node.Node, healthiness
 			memoryScore int64 = 100
 		)
 
-		if config.HostConfig.CPUShares > 0 {
-			cpuScore = (node.UsedCpus + config.HostConfig.CPUShares) * 100 / nodeCpus
+		if cpus > 0 {
+			cpuScore = (node.UsedCpus + cpus) * 100 / nodeCpus
 		}
-		if config.HostConfig.Memory > 0 {
-			memoryScore = (node.UsedMemory + config.HostConfig.Memory) * 100 / nodeMemory
+		if memory > 0 {
+			memoryScore = (node.UsedMemory + memory) * 100 / nodeMemory
 		}
 
 		if cpuScore <= 100 && memoryScore <= 100 {